@@ -0,0 +1,374 @@
+package main
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+    "os"
+    "sort"
+    "strings"
+    "text/tabwriter"
+    "time"
+
+    "github.com/2bleere/ha-vip/internal/api"
+    "github.com/2bleere/ha-vip/internal/config"
+    "github.com/2bleere/ha-vip/internal/election"
+    "github.com/2bleere/ha-vip/internal/k8s"
+    "github.com/2bleere/ha-vip/internal/maintenance"
+)
+
+// subcommands talk to a running daemon through its admin API
+var subcommands = map[string]func(args []string) error{
+    "status":      runStatus,
+    "peers":       runPeers,
+    "failover":    runFailover,
+    "step-down":   runStepDown,
+    "maintenance": runMaintenance,
+}
+
+// clientFlags are the flags shared by all subcommands
+type clientFlags struct {
+    configFile *string
+    socket     *string
+    addr       *string
+    tokenFile  *string
+    output     *string
+}
+
+func newClientFlags(name string) (*flag.FlagSet, *clientFlags) {
+    fs := flag.NewFlagSet(name, flag.ExitOnError)
+    return fs, &clientFlags{
+        configFile: fs.String("config", "/etc/ha-vip/config.yaml", "Configuration file to read the API socket or address from"),
+        socket:     fs.String("socket", "", "Admin API Unix socket (default: api.socket from the config, or "+api.DefaultSocket+")"),
+        addr:       fs.String("addr", "", "Admin API TCP address, used instead of the socket"),
+        tokenFile:  fs.String("token-file", "", "File with the admin API token for -addr (default: api.token from the config)"),
+        output:     fs.String("o", "table", "Output format: table or json"),
+    }
+}
+
+// client connects to the daemon named by the flags, falling back to the
+// API settings of the config file and then to the default socket
+func (f *clientFlags) client() (*api.Client, error) {
+    if *f.output != "table" && *f.output != "json" {
+        return nil, fmt.Errorf("unknown output format %q (expected table or json)", *f.output)
+    }
+    if *f.socket != "" && *f.addr == "" {
+        return api.NewClient(*f.socket), nil
+    }
+    var apiCfg config.APIConfig
+    if _, err := os.Stat(*f.configFile); err == nil {
+        // Without the API settings the default socket may still work
+        if apiCfg, err = config.LoadAPIConfig(*f.configFile); err != nil {
+            fmt.Fprintf(os.Stderr, "Warning: %v, using the defaults\n", err)
+            apiCfg = config.APIConfig{}
+        }
+    }
+    if *f.tokenFile != "" {
+        apiCfg.TokenFile = *f.tokenFile
+    }
+    if *f.addr != "" {
+        apiCfg.Socket, apiCfg.Listen = "", *f.addr
+    }
+    if apiCfg.Socket != "" {
+        return api.NewClient(apiCfg.Socket), nil
+    }
+    if apiCfg.Listen != "" {
+        // A token file from the config that this user cannot read only
+        // matters for failover and maintenance, which then fail with 403
+        token, err := apiCfg.LoadToken()
+        if err != nil && *f.tokenFile != "" {
+            return nil, err
+        }
+        return api.NewTCPClient(apiCfg.Listen, token), nil
+    }
+    return api.NewClient(api.DefaultSocket), nil
+}
+
+func runStatus(args []string) error {
+    fs, flags := newClientFlags("status")
+    fs.Parse(args)
+    client, err := flags.client()
+    if err != nil {
+        return err
+    }
+
+    status, err := client.Status()
+    if err != nil {
+        return err
+    }
+    if *flags.output == "json" {
+        return printJSON(status)
+    }
+
+    fmt.Printf("Node %s (version %s, up %s)\n\n", status.Node.NodeID, status.Node.Version,
+        time.Since(status.Node.StartedAt).Round(time.Second))
+
+    assigned := make(map[string]bool)
+    for _, v := range status.VIPs {
+        assigned[v.Group] = v.Assigned
+    }
+    vips := make(map[string]string)
+    for _, v := range status.VIPs {
+        vips[v.Group] = strings.Join(v.VIPs, ",")
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    fmt.Fprintln(w, "GROUP\tLEADER\tTERM\tQUORUM\tVIPS\tHELD HERE\tREASON")
+    for _, el := range status.Elections {
+        quorum := "-"
+        if el.Quorum.Enabled {
+            quorum = fmt.Sprintf("%d/%d", el.Quorum.Visible, el.Quorum.Total)
+            if !el.Quorum.HasQuorum {
+                quorum += " (lost)"
+            }
+        }
+        fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n", el.Group, orNone(el.Leader), el.Term, quorum,
+            vips[el.Group], yesNo(assigned[el.Group]), el.Decision.Reason)
+    }
+    w.Flush()
+    fmt.Println()
+
+    printNodes(status)
+
+    if len(status.Health) > 0 {
+        fmt.Println()
+        w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+        fmt.Fprintln(w, "CHECK\tTYPE\tHEALTHY\tWEIGHT\tPASSES\tFAILURES\tLAST ERROR")
+        for _, check := range status.Health {
+            weight := "-"
+            if check.Weight != 0 {
+                weight = fmt.Sprintf("%+d", check.Weight)
+            }
+            fmt.Fprintf(w, "%s\t%s\t%v\t%s\t%d\t%d\t%s\n", check.Name, check.Type, check.Healthy, weight,
+                check.Passes, check.Failures, check.LastError)
+        }
+        w.Flush()
+    }
+
+    var failing []k8s.EndpointCheck
+    for _, check := range status.K8s.Checks {
+        if !check.Healthy {
+            failing = append(failing, check)
+        }
+    }
+    if len(failing) > 0 {
+        fmt.Println()
+        w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+        fmt.Fprintln(w, "API SERVER CHECK\tENDPOINT\tCRITICAL\tMESSAGE")
+        for _, check := range failing {
+            fmt.Fprintf(w, "%s\t/%s\t%s\t%s\n", check.Name, check.Endpoint, yesNo(check.Critical), check.Message)
+        }
+        w.Flush()
+    }
+    if node := status.K8s.Node; node != nil && len(node.Problems) > 0 {
+        fmt.Printf("\nKubernetes node %s is unfit to hold the VIP: %s\n", node.Name, strings.Join(node.Problems, ", "))
+    }
+    for _, el := range status.Elections {
+        if lease := el.Lease; lease != nil && !lease.Available {
+            fmt.Printf("\nLease %s/%s of group %s is unavailable, the heartbeat election decides: %s\n",
+                lease.Namespace, lease.Name, el.Group, lease.LastError)
+        }
+    }
+
+    if len(status.Rejected) > 0 {
+        fmt.Println()
+        sources := make([]string, 0, len(status.Rejected))
+        for source := range status.Rejected {
+            sources = append(sources, source)
+        }
+        sort.Strings(sources)
+        for _, source := range sources {
+            stats := status.Rejected[source]
+            fmt.Printf("Rejected heartbeats from %s: unsigned=%d bad_signature=%d replayed=%d stale=%d identity=%d\n",
+                source, stats.Unsigned, stats.BadSignature, stats.Replayed, stats.Stale, stats.Identity)
+        }
+    }
+    return nil
+}
+
+func runPeers(args []string) error {
+    fs, flags := newClientFlags("peers")
+    fs.Parse(args)
+    client, err := flags.client()
+    if err != nil {
+        return err
+    }
+
+    if *flags.output == "json" {
+        peers, err := client.Peers()
+        if err != nil {
+            return err
+        }
+        return printJSON(peers)
+    }
+
+    status, err := client.Status()
+    if err != nil {
+        return err
+    }
+    printNodes(status)
+    return nil
+}
+
+func runFailover(args []string) error {
+    fs, flags := newClientFlags("failover")
+    to := fs.String("to", "", "Node to hand the VIP to (required)")
+    group := fs.String("group", "", "VIP group to hand over (default: every group this node leads)")
+    hold := fs.Duration("hold", election.DefaultHandoverHold, "How long the target stays leader regardless of priorities")
+    wait := fs.Duration("wait", 30*time.Second, "How long to wait for the handover to complete (0 to return at once)")
+    fs.Parse(args)
+    if *to == "" {
+        return fmt.Errorf("-to is required (use step-down to pick the next best node)")
+    }
+    return failover(flags, api.FailoverRequest{Group: *group, To: *to, HoldSeconds: int(hold.Seconds())}, *wait)
+}
+
+func runStepDown(args []string) error {
+    fs, flags := newClientFlags("step-down")
+    group := fs.String("group", "", "VIP group to step down from (default: every group this node leads)")
+    hold := fs.Duration("hold", election.DefaultHandoverHold, "How long the new leader stays leader regardless of priorities")
+    wait := fs.Duration("wait", 30*time.Second, "How long to wait for the handover to complete (0 to return at once)")
+    fs.Parse(args)
+    return failover(flags, api.FailoverRequest{Group: *group, HoldSeconds: int(hold.Seconds())}, *wait)
+}
+
+func runMaintenance(args []string) error {
+    if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+        return fmt.Errorf("usage: maintenance on|off|status [flags]")
+    }
+    action := args[0]
+    fs, flags := newClientFlags("maintenance")
+    reason := fs.String("reason", "", "Why the node is in maintenance, shown to other operators")
+    fs.Parse(args[1:])
+    client, err := flags.client()
+    if err != nil {
+        return err
+    }
+
+    var status *maintenance.Status
+    switch action {
+    case "on", "off":
+        status, err = client.SetMaintenance(api.MaintenanceRequest{Enabled: action == "on", Reason: *reason})
+    case "status":
+        status, err = client.Maintenance()
+    default:
+        return fmt.Errorf("unknown maintenance action %q (expected on, off or status)", action)
+    }
+    if err != nil {
+        return err
+    }
+    if *flags.output == "json" {
+        return printJSON(status)
+    }
+
+    if !status.Enabled {
+        fmt.Printf("Maintenance mode is off (%s)\n", status.File)
+        return nil
+    }
+    fmt.Printf("Maintenance mode is on since %s (%s)\n", status.Since.Format(time.RFC3339), status.File)
+    if status.Reason != "" {
+        fmt.Printf("Reason: %s\n", status.Reason)
+    }
+    return nil
+}
+
+// failover starts a handover on the leader and waits until every group has
+// moved to its target or the handover was abandoned
+func failover(flags *clientFlags, req api.FailoverRequest, wait time.Duration) error {
+    client, err := flags.client()
+    if err != nil {
+        return err
+    }
+
+    results, err := client.Failover(req)
+    if err != nil {
+        return err
+    }
+    for _, result := range results {
+        fmt.Printf("Handing over group %s from %s to %s\n", result.Group, result.From, result.To)
+    }
+    if wait <= 0 {
+        return nil
+    }
+
+    pending := make(map[string]string)
+    for _, result := range results {
+        pending[result.Group] = result.To
+    }
+    deadline := time.Now().Add(wait)
+    for len(pending) > 0 {
+        if time.Now().After(deadline) {
+            return fmt.Errorf("timed out after %v waiting for %d group(s) to hand over", wait, len(pending))
+        }
+        time.Sleep(250 * time.Millisecond)
+
+        elections, err := client.Elections()
+        if err != nil {
+            return err
+        }
+        for _, el := range elections {
+            target, ok := pending[el.Group]
+            if !ok {
+                continue
+            }
+            switch {
+            case el.Leader == target:
+                fmt.Printf("Group %s: %s now holds the VIP (term %d)\n", el.Group, target, el.Term)
+                delete(pending, el.Group)
+            case el.Handover == nil || el.Handover.Target != target:
+                return fmt.Errorf("handover of group %s to %s was abandoned: %s", el.Group, target, el.Decision.Reason)
+            }
+        }
+    }
+    return nil
+}
+
+// printNodes prints the local node followed by its peers, marking the
+// groups each node currently leads
+func printNodes(status *api.Status) {
+    leads := make(map[string][]string)
+    for _, el := range status.Elections {
+        if el.Leader != "" {
+            leads[el.Leader] = append(leads[el.Leader], el.Group)
+        }
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    fmt.Fprintln(w, "NODE\tPRIORITY\tHEALTHY\tMAINTENANCE\tK8S MODE\tLAST SEEN\tLEADER OF")
+    fmt.Fprintf(w, "%s (local)\t%s\t%v\t%s\t%v\t-\t%s\n", status.Node.NodeID, localPriority(status.Node),
+        status.Node.Healthy, yesNo(status.Node.Maintenance.Enabled), status.Node.K8sMode, strings.Join(leads[status.Node.NodeID], ","))
+    for _, peer := range status.Peers {
+        fmt.Fprintf(w, "%s\t%d\t%v\t%s\t%v\t%s ago\t%s\n", peer.NodeID, peer.Priority, peer.Healthy, yesNo(peer.Maintenance),
+            peer.K8sMode, (time.Duration(peer.Age * float64(time.Second))).Round(100*time.Millisecond), strings.Join(leads[peer.NodeID], ","))
+    }
+    w.Flush()
+}
+
+// localPriority shows the configured priority of the local node along with
+// the effective one when health check weights change it
+func localPriority(node api.NodeStatus) string {
+    if node.EffectivePriority == node.Priority {
+        return fmt.Sprint(node.Priority)
+    }
+    return fmt.Sprintf("%d (%+d)", node.EffectivePriority, node.EffectivePriority-node.Priority)
+}
+
+func printJSON(v interface{}) error {
+    encoder := json.NewEncoder(os.Stdout)
+    encoder.SetIndent("", "  ")
+    return encoder.Encode(v)
+}
+
+func orNone(leader string) string {
+    if leader == "" {
+        return "none"
+    }
+    return leader
+}
+
+func yesNo(b bool) string {
+    if b {
+        return "yes"
+    }
+    return "no"
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+
+    "github.com/2bleere/ha-vip/internal/api"
+)
+
+func TestLocalPriority(t *testing.T) {
+    tests := []struct {
+        priority  int
+        effective int
+        want      string
+    }{
+        {100, 100, "100"},
+        {100, 150, "150 (+50)"},
+        {100, 80, "80 (-20)"},
+    }
+    for _, tt := range tests {
+        node := api.NodeStatus{Priority: tt.priority, EffectivePriority: tt.effective}
+        if got := localPriority(node); got != tt.want {
+            t.Errorf("localPriority(%d, %d) = %q, want %q", tt.priority, tt.effective, got, tt.want)
+        }
+    }
+}
+
+func TestClientFlags(t *testing.T) {
+    dir := t.TempDir()
+    missing := filepath.Join(dir, "missing")
+
+    // Valid for the API, but the daemon refuses the unknown check type
+    invalid := filepath.Join(dir, "invalid.yaml")
+    os.WriteFile(invalid, []byte("node_id: node1\napi:\n  listen: 127.0.0.1:9406\nhealth_checks:\n  - name: x\n    type: bogus\n"), 0644)
+    unparsable := filepath.Join(dir, "unparsable.yaml")
+    os.WriteFile(unparsable, []byte("api: [\n"), 0644)
+
+    tests := []struct {
+        name    string
+        args    []string
+        wantErr bool
+    }{
+        {"default socket", []string{"-config", missing}, false},
+        {"socket flag", []string{"-config", missing, "-socket", "/tmp/ha-vip.sock"}, false},
+        {"tcp address", []string{"-config", missing, "-addr", "127.0.0.1:9100"}, false},
+        {"json output", []string{"-config", missing, "-o", "json"}, false},
+        {"unknown output", []string{"-config", missing, "-o", "yaml"}, true},
+        {"config failing validation", []string{"-config", invalid}, false},
+        {"unparsable config", []string{"-config", unparsable}, false},
+        {"unreadable token file", []string{"-config", missing, "-addr", "127.0.0.1:9100", "-token-file", missing}, true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            fs, flags := newClientFlags("status")
+            if err := fs.Parse(tt.args); err != nil {
+                t.Fatal(err)
+            }
+            client, err := flags.client()
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("client() error = %v, wantErr %v", err, tt.wantErr)
+            }
+            if err == nil && client == nil {
+                t.Error("client() returned no client")
+            }
+        })
+    }
+}
@@ -6,12 +6,18 @@ import (
     "log"
     "os"
     "os/signal"
+    "sync"
     "syscall"
+    "time"
 
+    "github.com/2bleere/ha-vip/internal/api"
     "github.com/2bleere/ha-vip/internal/config"
     "github.com/2bleere/ha-vip/internal/election"
+    "github.com/2bleere/ha-vip/internal/health"
     "github.com/2bleere/ha-vip/internal/heartbeat"
     "github.com/2bleere/ha-vip/internal/k8s"
+    "github.com/2bleere/ha-vip/internal/maintenance"
+    "github.com/2bleere/ha-vip/internal/metrics"
     "github.com/2bleere/ha-vip/internal/vip"
 )
 
@@ -23,9 +29,29 @@ var (
 )
 
 func main() {
+    // Subcommands query a running daemon instead of starting one
+    if len(os.Args) > 1 {
+        if run, ok := subcommands[os.Args[1]]; ok {
+            if err := run(os.Args[2:]); err != nil {
+                fmt.Fprintf(os.Stderr, "ha-vip %s: %v\n", os.Args[1], err)
+                os.Exit(1)
+            }
+            return
+        }
+    }
+    
     // Parse command-line flags
     configFile := flag.String("config", "config.yaml", "Path to configuration file")
     showVersion := flag.Bool("version", false, "Show version information and exit")
+    flag.Usage = func() {
+        fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags]          run the daemon\n", os.Args[0])
+        fmt.Fprintf(flag.CommandLine.Output(), "       %s status [flags]   show leaders, VIPs and nodes of a running daemon\n", os.Args[0])
+        fmt.Fprintf(flag.CommandLine.Output(), "       %s peers [flags]    show the nodes a running daemon sees\n", os.Args[0])
+        fmt.Fprintf(flag.CommandLine.Output(), "       %s failover -to <node> [flags]   hand the VIP to another node\n", os.Args[0])
+        fmt.Fprintf(flag.CommandLine.Output(), "       %s step-down [flags]            hand the VIP to the next best node\n", os.Args[0])
+        fmt.Fprintf(flag.CommandLine.Output(), "       %s maintenance on|off|status [flags]   keep this node out of elections\n\nFlags:\n", os.Args[0])
+        flag.PrintDefaults()
+    }
     flag.Parse()
     
     // Show version if requested
@@ -37,6 +63,10 @@ func main() {
     cfg := config.LoadConfig(*configFile)
     log.Printf("Starting HA VIP Manager v%s for %s", version, cfg.NodeID)
 
+    if cfg.MetricsListen != "" {
+        go metrics.Serve(cfg.MetricsListen)
+    }
+
     // Initialize K8s health checker if enabled
     var k8sChecker *k8s.K8sHealthChecker
     if cfg.K8s.Enabled {
@@ -49,14 +79,37 @@ func main() {
         log.Println("Kubernetes integration disabled")
     }
 
-    hb := heartbeat.NewHeartbeat(cfg, k8sChecker)
+    // Local health checks gate leadership alongside the K8s API check
+    healthChecks, err := health.NewManager(cfg.HealthChecks)
+    if err != nil {
+        log.Fatalf("Failed to set up health checks: %v", err)
+    }
+    go healthChecks.Start()
+
+    hb := heartbeat.NewHeartbeat(cfg, k8sChecker, healthChecks)
     go hb.Start()
 
-    el := election.NewElection(cfg, hb, k8sChecker)
-    go el.Run()
+    // Apply maintenance mode before the first election
+    maintenanceManager := maintenance.NewManager(cfg.MaintenanceFile, hb)
+    go maintenanceManager.Start()
+
+    // Run an independent election and VIP manager for every VIP group
+    var elections []*election.Election
+    var vipManagers []*vip.VIPManager
+    for _, group := range cfg.Groups() {
+        el := election.NewElection(cfg, group, hb, k8sChecker, healthChecks)
+        go el.Run()
+        elections = append(elections, el)
 
-    vipManager := vip.NewVIPManager(cfg)
-    go vipManager.MonitorLeadership(el)
+        vipManager := vip.NewVIPManager(cfg, group)
+        go vipManager.MonitorLeadership(el)
+        vipManagers = append(vipManagers, vipManager)
+    }
+
+    apiServer := api.NewServer(cfg, version, hb, k8sChecker, healthChecks, maintenanceManager, elections, vipManagers)
+    if err := apiServer.Start(); err != nil {
+        log.Printf("Failed to start admin API: %v", err)
+    }
 
     // Graceful shutdown
     sig := make(chan os.Signal, 1)
@@ -65,17 +118,56 @@ func main() {
     log.Println("Shutting down...")
     
     // Stop components in order
-    el.Stop()
-    vipManager.Stop()
-    hb.Stop()
+    apiServer.Stop()
+    if cfg.ShutdownHandoverTimeout > 0 {
+        stepDown(elections, time.Duration(cfg.ShutdownHandoverTimeout)*time.Second)
+    }
+    for _, el := range elections {
+        el.Stop()
+    }
+    for _, vipManager := range vipManagers {
+        vipManager.Stop()
+    }
+    maintenanceManager.Stop()
     
     // Stop K8s health checker if it was started
     if k8sChecker != nil {
         k8sChecker.Stop()
     }
+    healthChecks.Stop()
+    
+    // Release VIPs if we have them
+    for i, vipManager := range vipManagers {
+        if err := vipManager.ReleaseVIP(); err != nil {
+            log.Printf("Failed to release VIP on shutdown: %v", err)
+        }
+        elections[i].SetVIPHeld(vipManager.Status().Assigned)
+    }
+    k8sChecker.PublishPending()
     
-    // Release VIP if we have it
-    vipManager.ReleaseVIP()
+    // Let peers elect a new leader without waiting for our heartbeats to time out
+    hb.Leave()
+    hb.Stop()
     
     log.Println("Shutdown complete")
 }
+
+// stepDown hands every group this node leads to a successor and waits for
+// the successors to hold the VIPs, so they are released without a gap
+func stepDown(elections []*election.Election, timeout time.Duration) {
+    var wg sync.WaitGroup
+    for _, el := range elections {
+        if !el.IsLeader() {
+            continue
+        }
+        wg.Add(1)
+        go func(el *election.Election) {
+            defer wg.Done()
+            log.Printf("Handing group %s to a successor before shutting down", el.Group().Name)
+            if err := el.StepDown(timeout); err != nil {
+                log.Printf("Releasing VIPs of group %s without a successor: %v", el.Group().Name, err)
+            }
+        }(el)
+    }
+    wg.Wait()
+}
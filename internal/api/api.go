@@ -0,0 +1,381 @@
+// Package api serves the admin API of a running ha-vip daemon: JSON
+// snapshots of the local node, its peers, each VIP group's election and
+// VIPs, and the Kubernetes health checker.
+package api
+
+import (
+    "crypto/subtle"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "net"
+    "net/http"
+    "os"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/2bleere/ha-vip/internal/config"
+    "github.com/2bleere/ha-vip/internal/election"
+    "github.com/2bleere/ha-vip/internal/health"
+    "github.com/2bleere/ha-vip/internal/heartbeat"
+    "github.com/2bleere/ha-vip/internal/k8s"
+    "github.com/2bleere/ha-vip/internal/maintenance"
+    "github.com/2bleere/ha-vip/internal/vip"
+)
+
+// NodeStatus describes the local node
+type NodeStatus struct {
+    NodeID            string             `json:"node_id"`
+    Version           string             `json:"version"`
+    StartedAt         time.Time          `json:"started_at"`
+    Priority          int                `json:"priority"`
+    EffectivePriority int                `json:"effective_priority"` // After health check weights, as advertised to peers
+    Healthy           bool               `json:"healthy"`
+    K8sMode           bool               `json:"k8s_mode"`
+    Groups            []config.VIPGroup  `json:"groups"`
+    Maintenance       maintenance.Status `json:"maintenance"`
+}
+
+// PeerStatus describes a peer as seen through its heartbeats
+type PeerStatus struct {
+    NodeID      string                          `json:"node_id"`
+    LastSeen    time.Time                       `json:"last_seen"`
+    Age         float64                         `json:"age_seconds"`
+    Priority    int                             `json:"priority"`
+    Healthy     bool                            `json:"healthy"`
+    K8sMode     bool                            `json:"k8s_mode"`
+    Groups      map[string]heartbeat.GroupState `json:"groups,omitempty"`
+    Maintenance bool                            `json:"maintenance,omitempty"`
+}
+
+// K8sStatus describes the Kubernetes health checker
+type K8sStatus struct {
+    Enabled bool `json:"enabled"`
+    k8s.HealthStatus
+}
+
+// Status is the full snapshot returned by /v1/status
+type Status struct {
+    Node      NodeStatus                       `json:"node"`
+    Peers     []PeerStatus                     `json:"peers"`
+    Elections []election.Status                `json:"elections"`
+    VIPs      []vip.Status                     `json:"vips"`
+    K8s       K8sStatus                        `json:"k8s"`
+    Health    []health.CheckStatus             `json:"health_checks"`
+    Rejected  map[string]heartbeat.RejectStats `json:"rejected_heartbeats,omitempty"`
+}
+
+// FailoverRequest asks the leader to hand one or all of its VIP groups to
+// another node. An empty To picks the best other healthy node.
+type FailoverRequest struct {
+    Group       string `json:"group,omitempty"`
+    To          string `json:"to,omitempty"`
+    HoldSeconds int    `json:"hold_seconds,omitempty"`
+}
+
+// FailoverResult is the handover started for one group
+type FailoverResult struct {
+    Group string `json:"group"`
+    From  string `json:"from"`
+    To    string `json:"to"`
+}
+
+// MaintenanceRequest turns maintenance mode on or off
+type MaintenanceRequest struct {
+    Enabled bool   `json:"enabled"`
+    Reason  string `json:"reason,omitempty"`
+}
+
+// Server is the admin API of the daemon
+type Server struct {
+    cfg         *config.Config
+    version     string
+    startedAt   time.Time
+    hb          *heartbeat.Heartbeat
+    k8sChecker  *k8s.K8sHealthChecker
+    health      *health.Manager
+    maintenance *maintenance.Manager
+    elections   []*election.Election
+    vipManagers []*vip.VIPManager
+    token       string
+    servers     []*http.Server
+}
+
+func NewServer(cfg *config.Config, version string, hb *heartbeat.Heartbeat, k8sChecker *k8s.K8sHealthChecker,
+    healthChecks *health.Manager, maintenanceManager *maintenance.Manager, elections []*election.Election,
+    vipManagers []*vip.VIPManager) *Server {
+    return &Server{
+        cfg:         cfg,
+        version:     version,
+        startedAt:   time.Now(),
+        hb:          hb,
+        k8sChecker:  k8sChecker,
+        health:      healthChecks,
+        maintenance: maintenanceManager,
+        elections:   elections,
+        vipManagers: vipManagers,
+    }
+}
+
+// Start listens on the configured TCP address and Unix socket, if any
+func (s *Server) Start() error {
+    token, err := s.cfg.API.LoadToken()
+    if err != nil {
+        return err
+    }
+    s.token = token
+
+    if s.cfg.API.Socket != "" {
+        // Remove a socket left behind by a previous run
+        if info, err := os.Stat(s.cfg.API.Socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+            os.Remove(s.cfg.API.Socket)
+        }
+        listener, err := net.Listen("unix", s.cfg.API.Socket)
+        if err != nil {
+            return fmt.Errorf("failed to listen on %s: %w", s.cfg.API.Socket, err)
+        }
+        if err := os.Chmod(s.cfg.API.Socket, 0660); err != nil {
+            listener.Close()
+            return fmt.Errorf("failed to set permissions on %s: %w", s.cfg.API.Socket, err)
+        }
+        // Access to the socket is governed by its file permissions
+        s.serve(listener, s.handler(false))
+        log.Printf("API: Listening on unix socket %s", s.cfg.API.Socket)
+    }
+
+    if s.cfg.API.Listen != "" {
+        listener, err := net.Listen("tcp", s.cfg.API.Listen)
+        if err != nil {
+            s.Stop()
+            return fmt.Errorf("failed to listen on %s: %w", s.cfg.API.Listen, err)
+        }
+        s.serve(listener, s.handler(true))
+        if s.token == "" {
+            log.Printf("API: Listening on %s (read-only, set api.token to allow failover and maintenance)", s.cfg.API.Listen)
+        } else {
+            log.Printf("API: Listening on %s", s.cfg.API.Listen)
+        }
+    }
+
+    return nil
+}
+
+func (s *Server) serve(listener net.Listener, handler http.Handler) {
+    server := &http.Server{Handler: handler, ReadHeaderTimeout: 5 * time.Second}
+    s.servers = append(s.servers, server)
+    go func() {
+        if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+            log.Printf("API: Server on %s stopped: %v", listener.Addr(), err)
+        }
+    }()
+}
+
+func (s *Server) Stop() {
+    for _, server := range s.servers {
+        server.Close()
+    }
+    s.servers = nil
+}
+
+// handler serves the API. With requireToken, requests that change state
+// are refused unless they carry the configured bearer token.
+func (s *Server) handler(requireToken bool) http.Handler {
+    mutating := func(h http.HandlerFunc) http.HandlerFunc {
+        if !requireToken {
+            return h
+        }
+        return s.authorize(h)
+    }
+
+    mux := http.NewServeMux()
+    mux.HandleFunc("GET /v1/status", func(w http.ResponseWriter, r *http.Request) {
+        writeJSON(w, http.StatusOK, s.status())
+    })
+    mux.HandleFunc("GET /v1/node", func(w http.ResponseWriter, r *http.Request) {
+        writeJSON(w, http.StatusOK, s.nodeStatus())
+    })
+    mux.HandleFunc("GET /v1/peers", func(w http.ResponseWriter, r *http.Request) {
+        writeJSON(w, http.StatusOK, s.peerStatus())
+    })
+    mux.HandleFunc("GET /v1/elections", func(w http.ResponseWriter, r *http.Request) {
+        writeJSON(w, http.StatusOK, s.electionStatus())
+    })
+    mux.HandleFunc("GET /v1/vips", func(w http.ResponseWriter, r *http.Request) {
+        writeJSON(w, http.StatusOK, s.vipStatus())
+    })
+    mux.HandleFunc("GET /v1/k8s", func(w http.ResponseWriter, r *http.Request) {
+        writeJSON(w, http.StatusOK, s.k8sStatus())
+    })
+    mux.HandleFunc("GET /v1/health", func(w http.ResponseWriter, r *http.Request) {
+        writeJSON(w, http.StatusOK, s.health.Status())
+    })
+    mux.HandleFunc("POST /v1/failover", mutating(s.handleFailover))
+    mux.HandleFunc("GET /v1/maintenance", func(w http.ResponseWriter, r *http.Request) {
+        writeJSON(w, http.StatusOK, s.maintenance.Status())
+    })
+    mux.HandleFunc("PUT /v1/maintenance", mutating(s.handleMaintenance))
+    return mux
+}
+
+// authorize only passes requests that carry the API token. Without a
+// configured token every request is refused.
+func (s *Server) authorize(h http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if s.token == "" {
+            writeError(w, http.StatusForbidden, fmt.Errorf("%s %s is only allowed on the Unix socket unless api.token is set", r.Method, r.URL.Path))
+            return
+        }
+        token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+        if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+            log.Printf("API: Refused %s %s from %s: missing or wrong token", r.Method, r.URL.Path, r.RemoteAddr)
+            writeError(w, http.StatusForbidden, fmt.Errorf("missing or wrong API token"))
+            return
+        }
+        h(w, r)
+    }
+}
+
+func (s *Server) handleFailover(w http.ResponseWriter, r *http.Request) {
+    var req FailoverRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+        return
+    }
+    hold := time.Duration(req.HoldSeconds) * time.Second
+
+    // Without a group, hand over every group this node leads
+    var targets []*election.Election
+    for _, el := range s.elections {
+        if req.Group != "" && el.Group().Name != req.Group {
+            continue
+        }
+        if req.Group == "" && !el.IsLeader() {
+            continue
+        }
+        targets = append(targets, el)
+    }
+    if len(targets) == 0 {
+        if req.Group != "" {
+            writeError(w, http.StatusNotFound, fmt.Errorf("unknown VIP group %q", req.Group))
+        } else {
+            writeError(w, http.StatusConflict, fmt.Errorf("%s does not lead any VIP group", s.cfg.NodeID))
+        }
+        return
+    }
+
+    results := []FailoverResult{}
+    for _, el := range targets {
+        to, err := el.Failover(req.To, hold)
+        if err != nil {
+            if len(results) > 0 {
+                // Report the handovers that did start along with the error
+                err = fmt.Errorf("%w (handover already started for %d group(s))", err, len(results))
+            }
+            writeError(w, http.StatusConflict, err)
+            return
+        }
+        log.Printf("API: Manual failover of group %s to %s requested", el.Group().Name, to)
+        results = append(results, FailoverResult{Group: el.Group().Name, From: s.cfg.NodeID, To: to})
+    }
+    writeJSON(w, http.StatusOK, results)
+}
+
+func (s *Server) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+    var req MaintenanceRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+        return
+    }
+    if err := s.maintenance.Set(req.Enabled, req.Reason); err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    log.Printf("API: Maintenance mode set to %v", req.Enabled)
+    writeJSON(w, http.StatusOK, s.maintenance.Status())
+}
+
+func (s *Server) status() Status {
+    return Status{
+        Node:      s.nodeStatus(),
+        Peers:     s.peerStatus(),
+        Elections: s.electionStatus(),
+        VIPs:      s.vipStatus(),
+        K8s:       s.k8sStatus(),
+        Health:    s.health.Status(),
+        Rejected:  s.hb.GetRejectStats(),
+    }
+}
+
+func (s *Server) nodeStatus() NodeStatus {
+    return NodeStatus{
+        NodeID:            s.cfg.NodeID,
+        Version:           s.version,
+        StartedAt:         s.startedAt,
+        Priority:          s.cfg.Priority,
+        EffectivePriority: s.cfg.Priority + s.health.PriorityAdjustment(),
+        Healthy:           (!s.cfg.K8s.Enabled || s.k8sChecker.IsHealthy()) && s.health.IsHealthy(),
+        K8sMode:           s.cfg.K8s.Enabled,
+        Groups:            s.cfg.Groups(),
+        Maintenance:       s.maintenance.Status(),
+    }
+}
+
+func (s *Server) peerStatus() []PeerStatus {
+    now := time.Now()
+    peers := []PeerStatus{}
+    for nodeID, info := range s.hb.GetPeers() {
+        peers = append(peers, PeerStatus{
+            NodeID:      nodeID,
+            LastSeen:    info.LastSeen,
+            Age:         now.Sub(info.LastSeen).Seconds(),
+            Priority:    info.Priority,
+            Healthy:     info.Healthy,
+            K8sMode:     info.K8sMode,
+            Groups:      info.Groups,
+            Maintenance: info.Maintenance,
+        })
+    }
+    sort.Slice(peers, func(i, j int) bool {
+        return peers[i].NodeID < peers[j].NodeID
+    })
+    return peers
+}
+
+func (s *Server) electionStatus() []election.Status {
+    statuses := make([]election.Status, 0, len(s.elections))
+    for _, el := range s.elections {
+        statuses = append(statuses, el.Status())
+    }
+    return statuses
+}
+
+func (s *Server) vipStatus() []vip.Status {
+    statuses := make([]vip.Status, 0, len(s.vipManagers))
+    for _, vipManager := range s.vipManagers {
+        statuses = append(statuses, vipManager.Status())
+    }
+    return statuses
+}
+
+func (s *Server) k8sStatus() K8sStatus {
+    return K8sStatus{
+        Enabled:      s.k8sChecker != nil,
+        HealthStatus: s.k8sChecker.Status(),
+    }
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+    writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(code)
+    encoder := json.NewEncoder(w)
+    encoder.SetIndent("", "  ")
+    if err := encoder.Encode(v); err != nil {
+        log.Printf("API: Failed to write response: %v", err)
+    }
+}
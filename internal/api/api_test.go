@@ -0,0 +1,60 @@
+package api
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestAuthorize(t *testing.T) {
+    tests := []struct {
+        name   string
+        token  string
+        header string
+        want   int
+    }{
+        {"no token configured", "", "Bearer secret", http.StatusForbidden},
+        {"no header", "secret", "", http.StatusForbidden},
+        {"wrong token", "secret", "Bearer other", http.StatusForbidden},
+        {"not a bearer token", "secret", "secret", http.StatusForbidden},
+        {"right token", "secret", "Bearer secret", http.StatusNoContent},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            s := &Server{token: tt.token}
+            h := s.authorize(func(w http.ResponseWriter, r *http.Request) {
+                w.WriteHeader(http.StatusNoContent)
+            })
+
+            req := httptest.NewRequest(http.MethodPut, "/v1/maintenance", nil)
+            if tt.header != "" {
+                req.Header.Set("Authorization", tt.header)
+            }
+            rec := httptest.NewRecorder()
+            h(rec, req)
+            if rec.Code != tt.want {
+                t.Errorf("status = %d, want %d", rec.Code, tt.want)
+            }
+        })
+    }
+}
+
+func TestSocketHandlerSkipsToken(t *testing.T) {
+    s := &Server{}
+    req := httptest.NewRequest(http.MethodPost, "/v1/failover", nil)
+
+    // Over TCP the request is refused before the body is read
+    rec := httptest.NewRecorder()
+    s.handler(true).ServeHTTP(rec, req)
+    if rec.Code != http.StatusForbidden {
+        t.Errorf("TCP status = %d, want %d", rec.Code, http.StatusForbidden)
+    }
+
+    // On the socket it reaches the handler, which rejects the empty body
+    rec = httptest.NewRecorder()
+    s.handler(false).ServeHTTP(rec, req)
+    if rec.Code != http.StatusBadRequest {
+        t.Errorf("socket status = %d, want %d", rec.Code, http.StatusBadRequest)
+    }
+}
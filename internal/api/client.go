@@ -0,0 +1,158 @@
+package api
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/2bleere/ha-vip/internal/election"
+    "github.com/2bleere/ha-vip/internal/maintenance"
+)
+
+// DefaultSocket is where the CLI looks for the admin API when neither a
+// socket nor a config file naming one is given
+const DefaultSocket = "/run/ha-vip/ha-vip.sock"
+
+// Client talks to the admin API of a running daemon
+type Client struct {
+    baseURL    string
+    token      string
+    httpClient *http.Client
+}
+
+// NewClient returns a client for the daemon listening on a Unix socket
+func NewClient(socket string) *Client {
+    dialer := &net.Dialer{Timeout: 2 * time.Second}
+    return &Client{
+        baseURL: "http://ha-vip",
+        httpClient: &http.Client{
+            Timeout: 5 * time.Second,
+            Transport: &http.Transport{
+                DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+                    return dialer.DialContext(ctx, "unix", socket)
+                },
+            },
+        },
+    }
+}
+
+// NewTCPClient returns a client for the daemon listening on a TCP address.
+// The token, if any, is sent with requests that change state.
+func NewTCPClient(addr, token string) *Client {
+    return &Client{
+        baseURL:    "http://" + addr,
+        token:      token,
+        httpClient: &http.Client{Timeout: 5 * time.Second},
+    }
+}
+
+func (c *Client) Status() (*Status, error) {
+    var status Status
+    if err := c.get("/v1/status", &status); err != nil {
+        return nil, err
+    }
+    return &status, nil
+}
+
+func (c *Client) Peers() ([]PeerStatus, error) {
+    var peers []PeerStatus
+    if err := c.get("/v1/peers", &peers); err != nil {
+        return nil, err
+    }
+    return peers, nil
+}
+
+func (c *Client) Elections() ([]election.Status, error) {
+    var elections []election.Status
+    if err := c.get("/v1/elections", &elections); err != nil {
+        return nil, err
+    }
+    return elections, nil
+}
+
+// Failover asks the daemon to hand its VIP groups to another node
+func (c *Client) Failover(req FailoverRequest) ([]FailoverResult, error) {
+    var results []FailoverResult
+    if err := c.send(http.MethodPost, "/v1/failover", req, &results); err != nil {
+        return nil, err
+    }
+    return results, nil
+}
+
+// Maintenance returns the maintenance mode of the daemon's node
+func (c *Client) Maintenance() (*maintenance.Status, error) {
+    var status maintenance.Status
+    if err := c.get("/v1/maintenance", &status); err != nil {
+        return nil, err
+    }
+    return &status, nil
+}
+
+// SetMaintenance turns maintenance mode of the daemon's node on or off
+func (c *Client) SetMaintenance(req MaintenanceRequest) (*maintenance.Status, error) {
+    var status maintenance.Status
+    if err := c.send(http.MethodPut, "/v1/maintenance", req, &status); err != nil {
+        return nil, err
+    }
+    return &status, nil
+}
+
+func (c *Client) get(path string, v interface{}) error {
+    resp, err := c.httpClient.Get(c.baseURL + path)
+    if err != nil {
+        return fmt.Errorf("failed to reach ha-vip daemon: %w", err)
+    }
+    defer resp.Body.Close()
+    return decodeResponse(resp, v)
+}
+
+// send makes a request with a JSON body and decodes the JSON response
+func (c *Client) send(method, path string, body, v interface{}) error {
+    data, err := json.Marshal(body)
+    if err != nil {
+        return err
+    }
+    req, err := http.NewRequest(method, c.baseURL+path, bytes.NewReader(data))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    if c.token != "" {
+        req.Header.Set("Authorization", "Bearer "+c.token)
+    }
+
+    resp, err := c.httpClient.Do(req)
+    if err != nil {
+        return fmt.Errorf("failed to reach ha-vip daemon: %w", err)
+    }
+    defer resp.Body.Close()
+    return decodeResponse(resp, v)
+}
+
+// decodeResponse decodes a JSON response, turning error responses into
+// errors carrying the daemon's message
+func decodeResponse(resp *http.Response, v interface{}) error {
+    if resp.StatusCode >= 300 {
+        body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+        var apiErr struct {
+            Error string `json:"error"`
+        }
+        if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != "" {
+            return fmt.Errorf("%s", apiErr.Error)
+        }
+        return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+    }
+    if v == nil {
+        return nil
+    }
+    if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+        return fmt.Errorf("invalid response from daemon: %w", err)
+    }
+    return nil
+}
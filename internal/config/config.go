@@ -1,17 +1,152 @@
 package config
 
 import (
+    "fmt"
     "gopkg.in/yaml.v2"
     "log"
     "os"
+    "path"
+    "regexp"
+    "strings"
+    "time"
 )
 
+// annotationName matches the name part of a Kubernetes annotation key
+var annotationName = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+
+// DefaultGroup is the name of the VIP group built from the top-level vip
+// and interface settings when no vip_groups are configured
+const DefaultGroup = "default"
+
+// APIConfig controls the admin API of the running daemon. Requests that
+// change state are always accepted on the socket, but on the TCP address
+// only with Token (or the contents of TokenFile) as a bearer token.
+type APIConfig struct {
+    Listen    string `yaml:"listen"`     // TCP address, e.g. "127.0.0.1:9406"; empty disables it
+    Socket    string `yaml:"socket"`     // Unix socket path, e.g. "/run/ha-vip/ha-vip.sock"; empty disables it
+    Token     string `yaml:"token"`
+    TokenFile string `yaml:"token_file"` // Overrides token
+}
+
+// LoadToken returns the bearer token for the TCP address, read from
+// TokenFile when set; empty when neither is configured
+func (a APIConfig) LoadToken() (string, error) {
+    if a.TokenFile == "" {
+        return a.Token, nil
+    }
+    data, err := os.ReadFile(a.TokenFile)
+    if err != nil {
+        return "", fmt.Errorf("failed to read API token file %s: %w", a.TokenFile, err)
+    }
+    return strings.TrimSpace(string(data)), nil
+}
+
 type K8sConfig struct {
     Enabled     bool   `yaml:"enabled"`
     APIServer   string `yaml:"api_server"`
     Token       string `yaml:"token"`
+    TokenFile   string `yaml:"token_file"` // Overrides token, re-read when it changes
     CACert      string `yaml:"ca_cert"`
     InCluster   bool   `yaml:"in_cluster"`
+    // Kubeconfig is used instead of api_server, token and ca_cert when set;
+    // Context selects a context other than its current one. api_server, if
+    // also set, overrides the server named in the kubeconfig.
+    Kubeconfig  string `yaml:"kubeconfig"`
+    Context     string `yaml:"context"`
+    // ProbeURL sends the health probes to the API server on this host
+    // instead of api_server: a URL, or "auto" to find the local
+    // kube-apiserver. ProbeServerName is the name its certificate is
+    // verified against, by default the host of api_server.
+    ProbeURL        string `yaml:"probe_url"`
+    ProbeServerName string `yaml:"probe_server_name"`
+    // CriticalChecks and IgnoredChecks select the /readyz and /livez checks
+    // that decide health, as patterns like "poststarthook/*": every check,
+    // or only the critical ones when set, except the ignored ones. Livez
+    // probes /livez in addition to /readyz.
+    CriticalChecks  []string `yaml:"critical_checks"`
+    IgnoredChecks   []string `yaml:"ignored_checks"`
+    Livez           bool     `yaml:"livez"`
+    // WatchNode makes the node unhealthy while its Node object is
+    // NotReady, under memory, disk or PID pressure, cordoned, or carries a
+    // taint matching UnhealthyTaints. NodeName defaults to the host name.
+    WatchNode       bool     `yaml:"watch_node"`
+    NodeName        string   `yaml:"node_name"`
+    UnhealthyTaints []string `yaml:"unhealthy_taints"`
+    // PublishStatus records which node holds the VIPs: Events and an
+    // annotation on the holder's Node object, and an entry per group in
+    // the StatusConfigMap (default "ha-vip-status" in kube-system).
+    PublishStatus   bool     `yaml:"publish_status"`
+    StatusNamespace string   `yaml:"status_namespace"`
+    StatusConfigMap string   `yaml:"status_configmap"`
+}
+
+// LeaseConfig controls the Kubernetes Lease election backend. Durations
+// are in seconds and default to 15, 10 and 2, as in client-go.
+type LeaseConfig struct {
+    Name          string `yaml:"name"`      // Default "ha-vip"; groups other than default add "-<group>"
+    Namespace     string `yaml:"namespace"` // Default "kube-system"
+    LeaseDuration int    `yaml:"lease_duration"`
+    RenewDeadline int    `yaml:"renew_deadline"`
+    RetryPeriod   int    `yaml:"retry_period"`
+}
+
+// GARPConfig controls gratuitous ARP announcements for the VIP
+type GARPConfig struct {
+    Count           int `yaml:"count"`            // Announcements per burst
+    IntervalMs      int `yaml:"interval_ms"`      // Delay between announcements in a burst
+    RefreshInterval int `yaml:"refresh_interval"` // Seconds between refresh bursts while holding the VIP, 0 disables
+}
+
+// HealthCheckConfig is a local health check that must pass for the node to
+// be considered healthy, in addition to the Kubernetes API check
+type HealthCheckConfig struct {
+    Name     string `yaml:"name"`
+    Type     string `yaml:"type"`     // tcp, http, exec, file or etcd
+    Interval int    `yaml:"interval"` // Seconds between checks
+    Timeout  int    `yaml:"timeout"`  // Seconds before a check counts as failed
+    Rise     int    `yaml:"rise"`     // Consecutive passes to become healthy
+    Fall     int    `yaml:"fall"`     // Consecutive failures to become unhealthy
+    // Weight makes the check adjust the node's priority instead of its
+    // health: a positive weight is added to the priority while the check
+    // fails, a negative one while it passes. Lower priorities win.
+    Weight   int    `yaml:"weight"`
+    // tcp: host:port to connect to
+    Address string `yaml:"address"`
+    // http: URL to GET, the expected status (any 2xx when 0) and a regular
+    // expression the body must match
+    URL                string `yaml:"url"`
+    ExpectStatus       int    `yaml:"expect_status"`
+    ExpectBody         string `yaml:"expect_body"`
+    CACert             string `yaml:"ca_cert"`
+    InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+    // exec: command and arguments, healthy when it exits with status 0
+    Command []string `yaml:"command"`
+    // file: healthy while the file exists
+    Path string `yaml:"path"`
+    // etcd: url and ca_cert of the local member (kubeadm's by default), the
+    // client certificate to authenticate with, and how many raft entries
+    // the member may have committed but not yet applied
+    ClientCert string `yaml:"client_cert"`
+    ClientKey  string `yaml:"client_key"`
+    MaxRaftLag int    `yaml:"max_raft_lag"`
+}
+
+// VIPGroup is a set of VIPs that fail over together. Each group runs its own
+// election, so different groups can prefer different nodes.
+type VIPGroup struct {
+    Name      string   `yaml:"name" json:"name"`
+    VIPs      []string `yaml:"vips" json:"vips"`
+    Interface string   `yaml:"interface" json:"interface"` // Defaults to the top-level interface
+    Priority  int      `yaml:"priority" json:"priority"`   // This node's priority for the group, defaults to the top-level priority
+    K8sHealth *bool    `yaml:"k8s_health" json:"k8s_health,omitempty"` // Whether K8s API health gates this group, defaults to true
+    // HealthChecks names the health_checks that gate this group and adjust
+    // its priority; unset means every check, an empty list none
+    HealthChecks []string `yaml:"health_checks" json:"health_checks,omitempty"`
+}
+
+// UsesK8sHealth reports whether K8s API health counts towards this group
+func (g VIPGroup) UsesK8sHealth() bool {
+    return g.K8sHealth == nil || *g.K8sHealth
 }
 
 type Config struct {
@@ -20,12 +155,57 @@ type Config struct {
     Priority         int       `yaml:"priority"`
     Interface        string    `yaml:"interface"`
     VIP              string    `yaml:"vip"`
+    // VIPBackend selects how the VIP is configured: "auto" (netlink with
+    // ip command fallback), "netlink" or "exec"
+    VIPBackend       string    `yaml:"vip_backend"`
+    VIPLabel         string    `yaml:"vip_label"`
+    // VIPPreferredLifetime in seconds; unset means forever
+    VIPPreferredLifetime *int  `yaml:"vip_preferred_lifetime"`
+    VIPNoDAD         bool      `yaml:"vip_nodad"`
+    GARP             GARPConfig `yaml:"garp"`
+    VIPGroups        []VIPGroup `yaml:"vip_groups"`
     Peers            []string  `yaml:"peers"`
     Port             int       `yaml:"port"`
     HeartbeatInterval int      `yaml:"heartbeat_interval"`
     ElectionTimeout   int      `yaml:"election_timeout"`
+    // Quorum only lets a node lead while it sees a strict majority of the
+    // configured peers plus itself
+    Quorum           bool      `yaml:"quorum"`
+    // NoPreempt keeps a healthy leader in place even when a node with a
+    // better priority is available; PreemptDelay (seconds) instead lets the
+    // better node take over once it has been available that long
+    NoPreempt        bool      `yaml:"nopreempt"`
+    PreemptDelay     int       `yaml:"preempt_delay"`
+    // ElectionBackend selects who decides the leader: "heartbeat" (default)
+    // or "lease" for a Kubernetes Lease per group, with the heartbeat
+    // election as fallback while the Lease cannot be read
+    ElectionBackend  string    `yaml:"election_backend"`
+    Lease            LeaseConfig `yaml:"lease"`
     TLSCert          string    `yaml:"tls_cert"`
     TLSKey           string    `yaml:"tls_key"`
+    TLSCA            string    `yaml:"tls_ca"`
+    TLSServerName    string    `yaml:"tls_server_name"`
+    // HeartbeatTransport selects how heartbeats travel between peers:
+    // "udp" (default) or "tls" for mutually authenticated TLS over TCP.
+    HeartbeatTransport string  `yaml:"heartbeat_transport"`
+    // AuthKey (or the contents of AuthKeyFile) is a pre-shared key used to
+    // sign heartbeats; unsigned heartbeats are rejected when it is set.
+    AuthKey          string    `yaml:"auth_key"`
+    AuthKeyFile      string    `yaml:"auth_key_file"`
+    MaxClockSkew     int       `yaml:"max_clock_skew"`
+    // MetricsListen is the address (e.g. ":9405") on which Prometheus
+    // metrics are served at /metrics; empty disables the endpoint
+    MetricsListen    string    `yaml:"metrics_listen"`
+    API              APIConfig `yaml:"api"`
+    // MaintenanceFile marks the node as in maintenance while it exists,
+    // defaults to /var/lib/ha-vip/maintenance
+    MaintenanceFile  string    `yaml:"maintenance_file"`
+    // ShutdownHandoverTimeout is how many seconds a leader that is shutting
+    // down waits for a successor to hold its VIPs before releasing them;
+    // 0 releases them at once
+    ShutdownHandoverTimeout int `yaml:"shutdown_handover_timeout"`
+    // HealthChecks must all pass for the node to be healthy
+    HealthChecks     []HealthCheckConfig `yaml:"health_checks"`
 }
 
 func LoadConfig(path string) *Config {
@@ -37,5 +217,200 @@ func LoadConfig(path string) *Config {
     if err := yaml.Unmarshal(data, &cfg); err != nil {
         log.Fatalf("Failed to parse config: %v", err)
     }
+    if err := cfg.validateGroups(); err != nil {
+        log.Fatalf("Invalid config: %v", err)
+    }
+    if err := cfg.validateHealthChecks(); err != nil {
+        log.Fatalf("Invalid config: %v", err)
+    }
+    if err := cfg.validateK8s(); err != nil {
+        log.Fatalf("Invalid config: %v", err)
+    }
     return &cfg
 }
+
+// LoadAPIConfig reads only the api settings of a config file, ignoring the
+// rest, for clients that must not fail on settings only the daemon uses
+func LoadAPIConfig(path string) (APIConfig, error) {
+    var cfg struct {
+        API APIConfig `yaml:"api"`
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return cfg.API, fmt.Errorf("failed to read config: %w", err)
+    }
+    if err := yaml.Unmarshal(data, &cfg); err != nil {
+        return cfg.API, fmt.Errorf("failed to parse config: %w", err)
+    }
+    return cfg.API, nil
+}
+
+// LeaseDurations returns the Lease timings with defaults applied
+func (c *Config) LeaseDurations() (leaseDuration, renewDeadline, retryPeriod time.Duration) {
+    orDefault := func(seconds, fallback int) time.Duration {
+        if seconds <= 0 {
+            seconds = fallback
+        }
+        return time.Duration(seconds) * time.Second
+    }
+    return orDefault(c.Lease.LeaseDuration, 15), orDefault(c.Lease.RenewDeadline, 10), orDefault(c.Lease.RetryPeriod, 2)
+}
+
+// Groups returns the VIP groups this node manages with defaults applied. A
+// config without vip_groups yields a single group named DefaultGroup built
+// from the top-level vip, interface and priority.
+func (c *Config) Groups() []VIPGroup {
+    if len(c.VIPGroups) == 0 {
+        return []VIPGroup{{
+            Name:      DefaultGroup,
+            VIPs:      []string{c.VIP},
+            Interface: c.Interface,
+            Priority:  c.Priority,
+        }}
+    }
+
+    groups := make([]VIPGroup, 0, len(c.VIPGroups))
+    for _, group := range c.VIPGroups {
+        if group.Interface == "" {
+            group.Interface = c.Interface
+        }
+        if group.Priority == 0 {
+            group.Priority = c.Priority
+        }
+        groups = append(groups, group)
+    }
+    return groups
+}
+
+func (c *Config) validateGroups() error {
+    if len(c.VIPGroups) == 0 {
+        return nil
+    }
+    if c.VIP != "" {
+        return fmt.Errorf("vip and vip_groups are mutually exclusive")
+    }
+
+    seen := make(map[string]bool)
+    for i, group := range c.Groups() {
+        if group.Name == "" {
+            return fmt.Errorf("vip_groups[%d]: name is required", i)
+        }
+        if seen[group.Name] {
+            return fmt.Errorf("vip_groups[%d]: duplicate group name %q", i, group.Name)
+        }
+        seen[group.Name] = true
+        if len(group.VIPs) == 0 {
+            return fmt.Errorf("vip_groups[%d] (%s): at least one VIP is required", i, group.Name)
+        }
+        if group.Interface == "" {
+            return fmt.Errorf("vip_groups[%d] (%s): interface is required", i, group.Name)
+        }
+        for _, name := range group.HealthChecks {
+            if !c.hasHealthCheck(name) {
+                return fmt.Errorf("vip_groups[%d] (%s): unknown health check %q", i, group.Name, name)
+            }
+        }
+    }
+    return nil
+}
+
+func (c *Config) hasHealthCheck(name string) bool {
+    for _, check := range c.HealthChecks {
+        if check.Name == name {
+            return true
+        }
+    }
+    return false
+}
+
+func (c *Config) validateHealthChecks() error {
+    seen := make(map[string]bool)
+    for i, check := range c.HealthChecks {
+        if check.Name == "" {
+            return fmt.Errorf("health_checks[%d]: name is required", i)
+        }
+        if seen[check.Name] {
+            return fmt.Errorf("health_checks[%d]: duplicate check name %q", i, check.Name)
+        }
+        seen[check.Name] = true
+        if check.Interval < 0 || check.Timeout < 0 || check.Rise < 0 || check.Fall < 0 {
+            return fmt.Errorf("health_checks[%d] (%s): interval, timeout, rise and fall must not be negative", i, check.Name)
+        }
+
+        var missing string
+        switch check.Type {
+        case "tcp":
+            if check.Address == "" {
+                missing = "address"
+            }
+        case "http":
+            if check.URL == "" {
+                missing = "url"
+            }
+            if _, err := regexp.Compile(check.ExpectBody); err != nil {
+                return fmt.Errorf("health_checks[%d] (%s): invalid expect_body: %w", i, check.Name, err)
+            }
+        case "exec":
+            if len(check.Command) == 0 {
+                missing = "command"
+            }
+        case "file":
+            if check.Path == "" {
+                missing = "path"
+            }
+        case "etcd":
+            if (check.ClientCert == "") != (check.ClientKey == "") {
+                return fmt.Errorf("health_checks[%d] (%s): client_cert and client_key must be set together", i, check.Name)
+            }
+            if check.MaxRaftLag < 0 {
+                return fmt.Errorf("health_checks[%d] (%s): max_raft_lag must not be negative", i, check.Name)
+            }
+        default:
+            return fmt.Errorf("health_checks[%d] (%s): unknown type %q (expected tcp, http, exec, file or etcd)", i, check.Name, check.Type)
+        }
+        if missing != "" {
+            return fmt.Errorf("health_checks[%d] (%s): %s is required for %s checks", i, check.Name, missing, check.Type)
+        }
+    }
+    return nil
+}
+
+func (c *Config) validateK8s() error {
+    switch c.ElectionBackend {
+    case "", "heartbeat":
+    case "lease":
+        if !c.K8s.Enabled {
+            return fmt.Errorf("election_backend lease requires k8s.enabled")
+        }
+        lease, renew, retry := c.LeaseDurations()
+        if lease <= renew || float64(renew) <= 1.2*float64(retry) {
+            return fmt.Errorf("lease: lease_duration (%v) must exceed renew_deadline (%v), which must exceed 1.2 × retry_period (%v)",
+                lease, renew, retry)
+        }
+    default:
+        return fmt.Errorf("unknown election_backend %q (expected heartbeat or lease)", c.ElectionBackend)
+    }
+    for _, key := range []struct {
+        name     string
+        patterns []string
+    }{
+        {"critical_checks", c.K8s.CriticalChecks},
+        {"ignored_checks", c.K8s.IgnoredChecks},
+        {"unhealthy_taints", c.K8s.UnhealthyTaints},
+    } {
+        for i, pattern := range key.patterns {
+            if _, err := path.Match(pattern, ""); err != nil {
+                return fmt.Errorf("k8s.%s[%d]: invalid pattern %q", key.name, i, pattern)
+            }
+        }
+    }
+    if c.K8s.PublishStatus {
+        // Group names become annotation names and ConfigMap keys
+        for _, group := range c.Groups() {
+            if len(group.Name) > 63 || !annotationName.MatchString(group.Name) {
+                return fmt.Errorf("k8s.publish_status: group name %q is not a valid annotation name", group.Name)
+            }
+        }
+    }
+    return nil
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestLoadAPIConfig(t *testing.T) {
+    dir := t.TempDir()
+    tests := []struct {
+        name    string
+        data    string
+        want    APIConfig
+        wantErr bool
+    }{
+        {"api settings", "api:\n  listen: 127.0.0.1:9406\n  socket: /run/ha-vip.sock\n  token_file: /etc/ha-vip/token\n",
+            APIConfig{Listen: "127.0.0.1:9406", Socket: "/run/ha-vip.sock", TokenFile: "/etc/ha-vip/token"}, false},
+        {"daemon settings are ignored", "api:\n  socket: /run/ha-vip.sock\nhealth_checks:\n  - name: x\n    type: bogus\n",
+            APIConfig{Socket: "/run/ha-vip.sock"}, false},
+        {"no api settings", "node_id: node1\n", APIConfig{}, false},
+        {"unparsable", "api: [\n", APIConfig{}, true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            path := filepath.Join(dir, "config.yaml")
+            if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+                t.Fatal(err)
+            }
+            got, err := LoadAPIConfig(path)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("LoadAPIConfig() error = %v, wantErr %v", err, tt.wantErr)
+            }
+            if got != tt.want {
+                t.Errorf("LoadAPIConfig() = %+v, want %+v", got, tt.want)
+            }
+        })
+    }
+
+    if _, err := LoadAPIConfig(filepath.Join(dir, "missing")); err == nil {
+        t.Error("LoadAPIConfig() of a missing file succeeded")
+    }
+}
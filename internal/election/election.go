@@ -1,44 +1,102 @@
 package election
 
 import (
+    "fmt"
     "log"
     "sort"
     "sync"
     "time"
 
     "github.com/2bleere/ha-vip/internal/config"
+    "github.com/2bleere/ha-vip/internal/health"
     "github.com/2bleere/ha-vip/internal/heartbeat"
     "github.com/2bleere/ha-vip/internal/k8s"
+    "github.com/2bleere/ha-vip/internal/metrics"
 )
 
 type NodeInfo struct {
-    NodeID   string
-    Priority int
-    Healthy  bool
+    NodeID      string `json:"node_id"`
+    Priority    int    `json:"priority"`
+    Healthy     bool   `json:"healthy"`
+    Maintenance bool   `json:"maintenance,omitempty"`
 }
 
 type Election struct {
     cfg           *config.Config
+    group         config.VIPGroup
     hb            *heartbeat.Heartbeat
     k8sChecker    *k8s.K8sHealthChecker
+    healthChecks  *health.Manager
     leader        string
     mu            sync.RWMutex
     leaderChange  chan string
     stopCh        chan struct{}
     lastStatusLog time.Time
+    quorum        QuorumStatus
+    term          uint64
+    hbUpdates     <-chan struct{}
+    healthUpdates <-chan struct{}
+    // Preemption tracking: the better node waiting to take over and since when
+    preemptCandidate string
+    preemptSince     time.Time
+    // decision is the reason for the leader picked by the evaluation in
+    // progress; the last completed one is kept in lastDecision
+    decision     string
+    lastDecision Decision
+    // Manual failover started on this node, the handover target required
+    // by the evaluation in progress, and a channel to re-evaluate at once
+    handover   *handover
+    handoverTo string
+    kick       chan struct{}
+    // lease decides the leader instead when the lease backend is used
+    lease *leaseElection
+    // Whether the VIP manager last reported holding the VIPs, and since when
+    vipHeld     bool
+    vipReported bool
+    vipSince    time.Time
+    // Last reason a handover for maintenance failed, logged once
+    maintenanceError string
 }
 
-func NewElection(cfg *config.Config, hb *heartbeat.Heartbeat, k8sChecker *k8s.K8sHealthChecker) *Election {
-    return &Election{
-        cfg:          cfg,
-        hb:           hb,
-        k8sChecker:   k8sChecker,
-        leaderChange: make(chan string, 1),
-        stopCh:       make(chan struct{}),
+// NewElection creates the election for one VIP group. Each group elects its
+// leader independently using the priorities nodes advertise for it.
+func NewElection(cfg *config.Config, group config.VIPGroup, hb *heartbeat.Heartbeat, k8sChecker *k8s.K8sHealthChecker,
+    healthChecks *health.Manager) *Election {
+    e := &Election{
+        cfg:           cfg,
+        group:         group,
+        hb:            hb,
+        k8sChecker:    k8sChecker,
+        healthChecks:  healthChecks,
+        healthUpdates: healthChecks.Subscribe(),
+        leaderChange:  make(chan string, 1),
+        stopCh:        make(chan struct{}),
+        hbUpdates:     hb.Subscribe(),
+        kick:          make(chan struct{}, 1),
     }
+    e.lease = newLeaseElection(e)
+    return e
 }
 
 func (e *Election) Run() {
+    // Give peers one heartbeat timeout to be heard from before the first
+    // election, so a node that starts up does not claim leadership in a
+    // term that an existing leader already holds
+    if len(e.cfg.Peers) > 0 {
+        select {
+        case <-time.After(time.Duration(e.cfg.HeartbeatInterval*2) * time.Second):
+        case <-e.stopCh:
+            return
+        }
+    }
+    
+    // Read the Lease first, so that the initial election does not fall
+    // back to the heartbeat election while the Lease is available
+    if e.lease != nil {
+        e.lease.read()
+        go e.lease.run(e.stopCh)
+    }
+    
     // Initial election
     e.evaluate()
     
@@ -59,6 +117,15 @@ func (e *Election) Run() {
         case <-ticker.C:
             log.Printf("Election: Timer triggered, re-evaluating")
             e.evaluate()
+        case <-e.hbUpdates:
+            // A peer appeared or changed its leadership claim
+            e.evaluate()
+        case <-e.kick:
+            // A manual failover was requested
+            e.evaluate()
+        case <-e.healthUpdates:
+            log.Printf("Election: Local health check state changed, re-evaluating")
+            e.evaluate()
         case healthStatus := <-k8sHealthCh:
             // Immediate re-evaluation on health change
             log.Printf("Election: K8s health change detected (new status: %v), re-evaluating leadership immediately", healthStatus)
@@ -72,68 +139,185 @@ func (e *Election) Run() {
 
 func (e *Election) Stop() {
     close(e.stopCh)
+    e.lease.stop()
 }
 
 func (e *Election) GetLeaderChangeChan() <-chan string {
     return e.leaderChange
 }
 
+// Group returns the VIP group this election is for
+func (e *Election) Group() config.VIPGroup {
+    return e.group
+}
+
+// effectivePriority is this node's priority for the group after the weights
+// of the group's health checks
+func (e *Election) effectivePriority() int {
+    return e.group.Priority + e.healthChecks.PriorityAdjustmentFor(e.group.HealthChecks)
+}
+
+// usesK8sHealth reports whether K8s API health counts in this election
+func (e *Election) usesK8sHealth() bool {
+    return e.cfg.K8s.Enabled && e.group.UsesK8sHealth()
+}
+
+// handOverForMaintenance makes a leader entering maintenance hand the VIP
+// over instead of dropping it. While no node can take over it retries on
+// every evaluation, logging only when the reason changes.
+func (e *Election) handOverForMaintenance(localMaintenance bool) {
+    e.mu.RLock()
+    handingOver := e.handover != nil
+    e.mu.RUnlock()
+    if !localMaintenance || !e.IsLeader() || handingOver {
+        e.maintenanceError = ""
+        return
+    }
+
+    target, err := e.Failover("", DefaultHandoverHold)
+    failed := ""
+    if err != nil {
+        failed = err.Error()
+    }
+    logged := e.maintenanceError
+    e.maintenanceError = failed
+
+    switch {
+    case err != nil && failed != logged:
+        log.Printf("Election: Group %s - cannot hand over for maintenance: %v", e.group.Name, err)
+    case err == nil:
+        log.Printf("Election: Group %s - handing over to %s for maintenance", e.group.Name, target)
+    }
+}
+
+// recordMetrics updates the leadership metrics after an evaluation
+func (e *Election) recordMetrics(oldLeader, newLeader string, term uint64) {
+    metrics.IsLeader.SetBool(newLeader == e.cfg.NodeID, e.group.Name)
+    metrics.ElectionTerm.Set(float64(term), e.group.Name)
+    if oldLeader == newLeader {
+        return
+    }
+    
+    metrics.LeadershipTransitions.Inc(e.group.Name)
+    if oldLeader != "" {
+        metrics.Leader.Delete(e.group.Name, oldLeader)
+    }
+    if newLeader != "" {
+        metrics.Leader.Set(1, e.group.Name, newLeader)
+    }
+}
+
 func (e *Election) evaluate() {
     peers := e.hb.GetPeers()
+    e.expireHandover()
+    
+    localMaintenance := e.hb.InMaintenance()
+    e.handOverForMaintenance(localMaintenance)
+    e.handoverTo = e.handoverTarget(peers)
     
     // Build list of all nodes with their info
     var nodes []NodeInfo
     
     // Add local node
-    localHealthy := true
-    if e.cfg.K8s.Enabled && e.k8sChecker != nil {
-        localHealthy = e.k8sChecker.IsHealthy()
+    localHealthy := e.healthChecks.IsHealthyFor(e.group.HealthChecks)
+    if e.usesK8sHealth() && e.k8sChecker != nil {
+        localHealthy = localHealthy && e.k8sChecker.IsHealthy()
     }
     
+    localPriority := e.effectivePriority()
+    metrics.EffectivePriority.Set(float64(localPriority), e.group.Name)
     nodes = append(nodes, NodeInfo{
-        NodeID:   e.cfg.NodeID,
-        Priority: e.cfg.Priority,
-        Healthy:  localHealthy,
+        NodeID:      e.cfg.NodeID,
+        Priority:    localPriority,
+        Healthy:     localHealthy,
+        Maintenance: localMaintenance,
     })
     
-    // Add peer nodes with their reported health status
+    // Add peer nodes taking part in this group with their reported health status
     for peer, peerInfo := range peers {
-        peerHealthy := peerInfo.Healthy
+        state, ok := peerInfo.Group(e.group.Name)
+        if !ok {
+            continue
+        }
+        peerHealthy := state.Healthy
         
         // If peer is not in K8s mode but we are, consider them unhealthy
-        if e.cfg.K8s.Enabled && !peerInfo.K8sMode {
+        if e.usesK8sHealth() && !peerInfo.K8sMode {
             peerHealthy = false
         }
         
         nodes = append(nodes, NodeInfo{
-            NodeID:   peer,
-            Priority: peerInfo.Priority,
-            Healthy:  peerHealthy,
+            NodeID:      peer,
+            Priority:    state.Priority,
+            Healthy:     peerHealthy,
+            Maintenance: peerInfo.Maintenance,
         })
     }
     
-    // Select leader based on K8s health and priority
-    newLeader := e.selectLeader(nodes)
+    // Select leader based on K8s health and priority. Without quorum no
+    // node is leader from our point of view, so we never claim the VIP.
+    quorum := e.checkQuorum(peers)
+    e.updateQuorum(quorum)
+    newLeader := ""
+    e.decision = ""
+    e.lease.setCandidate(e.leaseCandidate(nodes))
+    if holder, ok := e.lease.leader(); ok {
+        // The Lease decides; quorum and priorities only apply in fallback
+        newLeader = e.selectLeaseLeader(holder)
+    } else if quorum.HasQuorum {
+        newLeader = e.selectLeader(nodes)
+        e.leaseFallback()
+    } else {
+        e.decide("no quorum (%d/%d nodes visible, need %d)", quorum.Visible, quorum.Total, quorum.Total/2+1)
+        e.leaseFallback()
+    }
     
     e.mu.Lock()
     oldLeader := e.leader
+    newLeader, e.term = e.resolveTerm(newLeader, oldLeader, e.term, peers)
     e.leader = newLeader
+    term := e.term
+    now := time.Now()
+    changedAt := e.lastDecision.ChangedAt
+    if oldLeader != newLeader || changedAt.IsZero() {
+        changedAt = now
+    }
+    advertisedHandover := ""
+    if e.handover != nil {
+        advertisedHandover = e.handover.target
+    }
+    e.lastDecision = Decision{
+        Leader:     newLeader,
+        Term:       term,
+        Reason:     e.decision,
+        Time:       now,
+        ChangedAt:  changedAt,
+        Candidates: nodes,
+    }
     e.mu.Unlock()
     
+    e.hb.SetLeadership(e.group.Name, newLeader, term, advertisedHandover)
+    e.recordMetrics(oldLeader, newLeader, term)
+    
     // Only log when leadership actually changes or there's a significant event
     if oldLeader != newLeader {
-        log.Printf("Leadership changed from %s to %s - notifying VIP manager", oldLeader, newLeader)
+        log.Printf("Leadership of group %s changed from %s to %s (term %d) - notifying VIP manager", 
+            e.group.Name, displayLeader(oldLeader), displayLeader(newLeader), term)
         
         // Log detailed election info only on leadership change
         log.Printf("Election: Leadership evaluation triggered by change")
-        log.Printf("Election: Local K8s health status: %v", localHealthy)
+        log.Printf("Election: Local health status: %v", localHealthy)
         for peer, peerInfo := range peers {
-            peerHealthy := peerInfo.Healthy
-            if e.cfg.K8s.Enabled && !peerInfo.K8sMode {
+            state, ok := peerInfo.Group(e.group.Name)
+            if !ok {
+                continue
+            }
+            peerHealthy := state.Healthy
+            if e.usesK8sHealth() && !peerInfo.K8sMode {
                 peerHealthy = false
             }
             log.Printf("Election: Peer %s - Priority: %d, Healthy: %v, K8sMode: %v (LastSeen: %v ago)", 
-                peer, peerInfo.Priority, peerHealthy, peerInfo.K8sMode, time.Since(peerInfo.LastSeen).Round(time.Second))
+                peer, state.Priority, peerHealthy, peerInfo.K8sMode, time.Since(peerInfo.LastSeen).Round(time.Second))
         }
         
         select {
@@ -144,7 +328,6 @@ func (e *Election) evaluate() {
     }
     
     // Log current status periodically (every 30 seconds) or on change
-    now := time.Now()
     var shouldLog bool
     e.mu.Lock()
     if e.lastStatusLog.IsZero() || now.Sub(e.lastStatusLog) >= 30*time.Second || oldLeader != newLeader {
@@ -156,43 +339,68 @@ func (e *Election) evaluate() {
     e.mu.Unlock()
     
     if shouldLog {
-        if e.cfg.K8s.Enabled {
+        if e.usesK8sHealth() {
             healthyCount := 0
             for _, node := range nodes {
                 if node.Healthy {
                     healthyCount++
                 }
             }
-            log.Printf("Current leader: %s (K8s enabled, local healthy: %v, %d/%d nodes healthy)", 
-                e.leader, localHealthy, healthyCount, len(nodes))
+            log.Printf("Current leader of group %s: %s (K8s enabled, local healthy: %v, %d/%d nodes healthy)", 
+                e.group.Name, displayLeader(newLeader), localHealthy, healthyCount, len(nodes))
         } else {
-            log.Printf("Current leader: %s (K8s disabled, %d total nodes)", e.leader, len(nodes))
+            log.Printf("Current leader of group %s: %s (K8s health not used, %d total nodes)", e.group.Name, displayLeader(newLeader), len(nodes))
+        }
+        if quorum.Enabled {
+            log.Printf("Election: Quorum for group %s: %v (%d/%d nodes visible)", e.group.Name, quorum.HasQuorum, quorum.Visible, quorum.Total)
         }
     }
 }
 
 func (e *Election) selectLeader(nodes []NodeInfo) string {
     if len(nodes) == 0 {
+        e.decide("no candidates, electing ourselves")
         return e.cfg.NodeID
     }
     
     // Enhanced debug logging
     log.Printf("Election: selectLeader called with %d nodes:", len(nodes))
     for i, node := range nodes {
-        log.Printf("  Node %d: ID=%s, Priority=%d, Healthy=%v", i, node.NodeID, node.Priority, node.Healthy)
+        log.Printf("  Node %d: ID=%s, Priority=%d, Healthy=%v, Maintenance=%v", i, node.NodeID, node.Priority, node.Healthy, node.Maintenance)
     }
     
-    if !e.cfg.K8s.Enabled {
-        // If K8s is disabled, use simple alphabetical sorting
+    // Nodes in maintenance mode are never elected
+    var eligible []NodeInfo
+    for _, node := range nodes {
+        if !node.Maintenance {
+            eligible = append(eligible, node)
+        }
+    }
+    if len(eligible) == 0 {
+        log.Printf("Election: Group %s - every node is in maintenance mode, no leader", e.group.Name)
+        e.decide("every node is in maintenance mode")
+        return ""
+    }
+    nodes = eligible
+    
+    if !e.cfg.K8s.Enabled && len(e.cfg.HealthChecks) == 0 {
+        // If K8s is disabled, use simple alphabetical sorting, as nodes
+        // did before health checks existed. Configuring health checks
+        // switches to the health and priority based selection below.
         var candidates []string
         for _, node := range nodes {
+            if node.NodeID == e.handoverTo {
+                e.decide("manual failover to %s", node.NodeID)
+                return node.NodeID
+            }
             candidates = append(candidates, node.NodeID)
         }
         sort.Strings(candidates)
+        e.decide("lowest node ID of %d nodes", len(candidates))
         return candidates[0]
     }
     
-    // K8s-aware leader selection
+    // Health-aware leader selection
     
     // Step 1: Find healthy nodes
     var healthyNodes []NodeInfo
@@ -217,8 +425,25 @@ func (e *Election) selectLeader(nodes []NodeInfo) string {
             return healthyNodes[i].Priority < healthyNodes[j].Priority
         })
         
-        leader := healthyNodes[0].NodeID
-        log.Printf("Selected healthy leader: %s (priority: %d)", leader, healthyNodes[0].Priority)
+        // A manual failover overrides priorities while its target is healthy
+        if e.handoverTo != "" {
+            for _, node := range healthyNodes {
+                if node.NodeID == e.handoverTo {
+                    e.decide("manual failover to %s", node.NodeID)
+                    e.preemptCandidate = ""
+                    return node.NodeID
+                }
+            }
+        }
+        
+        e.decide("best priority (%d) among %d healthy of %d nodes", healthyNodes[0].Priority, len(healthyNodes), len(nodes))
+        leader := e.applyPreemption(healthyNodes[0], healthyNodes)
+        for _, node := range healthyNodes {
+            if node.NodeID == leader {
+                log.Printf("Selected healthy leader: %s (priority: %d)", leader, node.Priority)
+                break
+            }
+        }
         return leader
     }
     
@@ -232,10 +457,44 @@ func (e *Election) selectLeader(nodes []NodeInfo) string {
     })
     
     leader := nodes[0].NodeID
+    e.decide("no healthy nodes, best priority (%d) regardless of health", nodes[0].Priority)
     log.Printf("No healthy nodes, selected highest priority leader: %s (priority: %d)", leader, nodes[0].Priority)
     return leader
 }
 
+// decide records why the evaluation in progress picked its leader
+func (e *Election) decide(format string, args ...interface{}) {
+    e.decision = fmt.Sprintf(format, args...)
+}
+
+// displayLeader formats a leader for logs, where "" means no leader
+func displayLeader(leader string) string {
+    if leader == "" {
+        return "none"
+    }
+    return leader
+}
+
+// SetVIPHeld is called by the VIP manager to advertise whether this node
+// holds the group's VIPs, which a manual failover waits for. Changes, and
+// the first report after startup, are also published to Kubernetes.
+func (e *Election) SetVIPHeld(held bool) {
+    e.hb.SetVIPHeld(e.group.Name, held)
+
+    e.mu.Lock()
+    changed := !e.vipReported || e.vipHeld != held
+    if changed {
+        e.vipHeld = held
+        e.vipReported = true
+        e.vipSince = time.Now()
+    }
+    ownership := k8s.VIPOwnership{Group: e.group.Name, VIPs: e.group.VIPs, Held: held, Term: e.term, Since: e.vipSince}
+    e.mu.Unlock()
+    if changed {
+        e.k8sChecker.PublishVIP(ownership)
+    }
+}
+
 func (e *Election) IsLeader() bool {
     e.mu.RLock()
     defer e.mu.RUnlock()
@@ -0,0 +1,50 @@
+package election
+
+import (
+    "testing"
+
+    "github.com/2bleere/ha-vip/internal/config"
+)
+
+func TestSelectLeader(t *testing.T) {
+    nodes := []NodeInfo{
+        {NodeID: "node3", Priority: 1, Healthy: true},
+        {NodeID: "node1", Priority: 3, Healthy: true},
+        {NodeID: "node2", Priority: 2, Healthy: false},
+    }
+    check := []config.HealthCheckConfig{{Name: "haproxy", Type: "tcp"}}
+
+    tests := []struct {
+        name         string
+        k8s          bool
+        healthChecks []config.HealthCheckConfig
+        nodes        []NodeInfo
+        handoverTo   string
+        want         string
+    }{
+        {"without K8s or checks the lowest node ID leads", false, nil, nodes, "", "node1"},
+        {"K8s picks the best healthy priority", true, nil, nodes, "", "node3"},
+        {"health checks pick the best healthy priority", false, check, nodes, "", "node3"},
+        {"maintenance excludes the lowest node ID", false, nil, []NodeInfo{
+            {NodeID: "node1", Maintenance: true}, {NodeID: "node2"}}, "", "node2"},
+        {"every node in maintenance", false, nil, []NodeInfo{{NodeID: "node1", Maintenance: true}}, "", ""},
+        {"manual failover without K8s", false, nil, nodes, "node3", "node3"},
+        {"no healthy node falls back to priority", true, nil, []NodeInfo{
+            {NodeID: "node1", Priority: 2}, {NodeID: "node2", Priority: 1}}, "", "node2"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg := &config.Config{NodeID: "node1", HealthChecks: tt.healthChecks}
+            cfg.K8s.Enabled = tt.k8s
+            e := &Election{
+                cfg:        cfg,
+                group:      config.VIPGroup{Name: config.DefaultGroup},
+                handoverTo: tt.handoverTo,
+            }
+            nodes := append([]NodeInfo(nil), tt.nodes...)
+            if got := e.selectLeader(nodes); got != tt.want {
+                t.Errorf("selectLeader() = %q, want %q (decision: %s)", got, tt.want, e.decision)
+            }
+        })
+    }
+}
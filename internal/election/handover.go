@@ -0,0 +1,219 @@
+package election
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "sort"
+    "time"
+
+    "github.com/2bleere/ha-vip/internal/heartbeat"
+)
+
+// DefaultHandoverHold is how long every node keeps the handover target as
+// leader after a manual failover, unless the caller asks otherwise
+const DefaultHandoverHold = 5 * time.Minute
+
+// handoverTimeout bounds how long the leader keeps the VIP while waiting for
+// the target of a manual failover to take it; after that the handover is
+// abandoned. StepDown waits for as long as it is asked to instead.
+const handoverTimeout = 15 * time.Second
+
+// ErrNotLeader is returned by Failover when this node does not lead the group
+var ErrNotLeader = errors.New("this node is not the leader")
+
+// handover is a manual failover started on this node
+type handover struct {
+    target    string
+    started   time.Time
+    until     time.Time     // End of the hold period
+    timeout   time.Duration // How long to wait for the target to take over
+    completed bool          // The target has taken over the VIP
+}
+
+// HandoverStatus describes a manual failover started on this node
+type HandoverStatus struct {
+    Target    string    `json:"target"`
+    Started   time.Time `json:"started"`
+    HoldUntil time.Time `json:"hold_until"`
+    Completed bool      `json:"completed"`
+}
+
+// Failover hands leadership of the group to target, or to the best other
+// healthy node when target is empty. The VIP stays on this node until the
+// target reports that it holds it, and every node then keeps the target as
+// leader for the hold period. It returns the node chosen as target.
+func (e *Election) Failover(target string, hold time.Duration) (string, error) {
+    return e.failover(target, hold, handoverTimeout)
+}
+
+// failover starts a handover that is abandoned when target has not taken
+// over within timeout
+func (e *Election) failover(target string, hold, timeout time.Duration) (string, error) {
+    if hold <= 0 {
+        hold = DefaultHandoverHold
+    }
+
+    e.mu.Lock()
+    if e.leader != e.cfg.NodeID {
+        leader := e.leader
+        e.mu.Unlock()
+        return "", fmt.Errorf("%w of group %s (leader: %s)", ErrNotLeader, e.group.Name, displayLeader(leader))
+    }
+    if target == e.cfg.NodeID {
+        e.mu.Unlock()
+        return "", fmt.Errorf("%s already leads group %s", target, e.group.Name)
+    }
+
+    // Pick from the candidates of the latest evaluation
+    candidates := append([]NodeInfo(nil), e.lastDecision.Candidates...)
+    sort.Slice(candidates, func(i, j int) bool {
+        if candidates[i].Priority == candidates[j].Priority {
+            return candidates[i].NodeID < candidates[j].NodeID
+        }
+        return candidates[i].Priority < candidates[j].Priority
+    })
+    chosen := ""
+    for _, node := range candidates {
+        if node.NodeID == e.cfg.NodeID || (target != "" && node.NodeID != target) {
+            continue
+        }
+        if node.Maintenance {
+            if target == "" {
+                continue
+            }
+            e.mu.Unlock()
+            return "", fmt.Errorf("%s is in maintenance mode", node.NodeID)
+        }
+        if !node.Healthy {
+            if target == "" {
+                continue
+            }
+            e.mu.Unlock()
+            return "", fmt.Errorf("%s is not healthy in group %s", node.NodeID, e.group.Name)
+        }
+        chosen = node.NodeID
+        break
+    }
+    if chosen == "" {
+        e.mu.Unlock()
+        if target != "" {
+            return "", fmt.Errorf("%s is not an active member of group %s", target, e.group.Name)
+        }
+        return "", fmt.Errorf("no other healthy node in group %s to hand over to", e.group.Name)
+    }
+
+    now := time.Now()
+    e.handover = &handover{target: chosen, started: now, until: now.Add(hold), timeout: timeout}
+    e.mu.Unlock()
+
+    log.Printf("Election: Group %s - manual failover to %s requested (hold %v)", e.group.Name, chosen, hold)
+    select {
+    case e.kick <- struct{}{}:
+    default:
+    }
+    return chosen, nil
+}
+
+// StepDown hands leadership of the group to the best other healthy node, if
+// this node leads it, and waits up to timeout for the new leader to hold the
+// VIP. It is used on shutdown so that the VIP is never left without an owner.
+func (e *Election) StepDown(timeout time.Duration) error {
+    if !e.IsLeader() {
+        return nil
+    }
+    target, err := e.failover("", DefaultHandoverHold, timeout)
+    if err != nil {
+        return err
+    }
+
+    deadline := time.Now().Add(timeout)
+    for e.IsLeader() {
+        if time.Now().After(deadline) {
+            return fmt.Errorf("%s did not take over group %s within %v", target, e.group.Name, timeout)
+        }
+        e.mu.RLock()
+        abandoned := e.handover == nil || e.handover.target != target
+        e.mu.RUnlock()
+        if abandoned {
+            return fmt.Errorf("handover of group %s to %s was abandoned", e.group.Name, target)
+        }
+        time.Sleep(100 * time.Millisecond)
+    }
+    return nil
+}
+
+// expireHandover ends the hold period of a completed handover and abandons
+// one whose target did not take over in time
+func (e *Election) expireHandover() {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+
+    if e.handover == nil {
+        return
+    }
+    now := time.Now()
+    if !e.handover.completed && now.Sub(e.handover.started) > e.handover.timeout {
+        log.Printf("Election: Group %s - %s did not take over within %v, abandoning handover",
+            e.group.Name, e.handover.target, e.handover.timeout)
+        e.handover = nil
+    } else if now.After(e.handover.until) {
+        log.Printf("Election: Group %s - hold period for handover to %s ended", e.group.Name, e.handover.target)
+        e.handover = nil
+    }
+}
+
+// handoverTarget returns the node a handover, started here or advertised
+// by a peer, currently requires as leader
+func (e *Election) handoverTarget(peers map[string]heartbeat.PeerInfo) string {
+    e.mu.RLock()
+    if e.handover != nil {
+        target := e.handover.target
+        e.mu.RUnlock()
+        return target
+    }
+    e.mu.RUnlock()
+
+    var names []string
+    for peer := range peers {
+        names = append(names, peer)
+    }
+    sort.Strings(names)
+    for _, peer := range names {
+        if state, ok := peers[peer].Group(e.group.Name); ok && state.Handover != "" {
+            return state.Handover
+        }
+    }
+    return ""
+}
+
+// completeHandover decides, while this node still leads, whether the
+// handover target has taken the VIP so that this node can release it. It is
+// called with e.mu held.
+func (e *Election) completeHandover(claims []leaderClaim, term uint64) (string, uint64) {
+    target := e.handover.target
+    for _, claim := range claims {
+        if claim.NodeID == target && claim.HoldsVIP {
+            e.handover.completed = true
+            log.Printf("Election: Group %s - %s holds the VIP (term %d), releasing it", e.group.Name, target, claim.Term)
+            e.decide("handed over to %s (term %d)", target, claim.Term)
+            return target, term
+        }
+    }
+    e.decide("handing over to %s, waiting for it to hold the VIP", target)
+    return e.cfg.NodeID, e.term
+}
+
+// handoverStatus reports the handover started on this node, if any. It is
+// called with e.mu held.
+func (e *Election) handoverStatus() *HandoverStatus {
+    if e.handover == nil {
+        return nil
+    }
+    return &HandoverStatus{
+        Target:    e.handover.target,
+        Started:   e.handover.started,
+        HoldUntil: e.handover.until,
+        Completed: e.handover.completed,
+    }
+}
@@ -0,0 +1,207 @@
+package election
+
+import (
+    "bytes"
+    "errors"
+    "log"
+    "os"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/2bleere/ha-vip/internal/config"
+)
+
+func TestFailoverTarget(t *testing.T) {
+    candidates := []NodeInfo{
+        {NodeID: "node1", Priority: 1, Healthy: true},
+        {NodeID: "node2", Priority: 3, Healthy: true},
+        {NodeID: "node3", Priority: 2, Healthy: true, Maintenance: true},
+        {NodeID: "node4", Priority: 2, Healthy: false},
+        {NodeID: "node5", Priority: 3, Healthy: true},
+    }
+
+    tests := []struct {
+        name    string
+        leader  string
+        target  string
+        want    string
+        wantErr bool
+    }{
+        {"best other healthy node", "node1", "", "node2", false},
+        {"requested node", "node1", "node5", "node5", false},
+        {"requested node in maintenance", "node1", "node3", "", true},
+        {"requested node unhealthy", "node1", "node4", "", true},
+        {"requested node unknown", "node1", "node9", "", true},
+        {"requested node is this one", "node1", "node1", "", true},
+        {"not the leader", "node2", "", "", true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            e := &Election{
+                cfg:          &config.Config{NodeID: "node1"},
+                group:        config.VIPGroup{Name: config.DefaultGroup},
+                leader:       tt.leader,
+                lastDecision: Decision{Candidates: candidates},
+                kick:         make(chan struct{}, 1),
+            }
+            got, err := e.Failover(tt.target, 0)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("Failover() error = %v, wantErr %v", err, tt.wantErr)
+            }
+            if got != tt.want {
+                t.Errorf("Failover() = %q, want %q", got, tt.want)
+            }
+            if err == nil && (e.handover == nil || e.handover.target != tt.want) {
+                t.Errorf("handover = %+v, want target %s", e.handover, tt.want)
+            }
+            if err != nil && e.handover != nil {
+                t.Errorf("handover = %+v after failed Failover", e.handover)
+            }
+        })
+    }
+}
+
+func TestFailoverNotLeader(t *testing.T) {
+    e := &Election{
+        cfg:    &config.Config{NodeID: "node1"},
+        group:  config.VIPGroup{Name: config.DefaultGroup},
+        leader: "node2",
+    }
+    if _, err := e.Failover("", 0); !errors.Is(err, ErrNotLeader) {
+        t.Errorf("Failover() error = %v, want ErrNotLeader", err)
+    }
+}
+
+func TestCompleteHandover(t *testing.T) {
+    tests := []struct {
+        name   string
+        claims []leaderClaim
+        want   string
+    }{
+        {"target has not claimed", nil, "node1"},
+        {"target claims without the VIP", []leaderClaim{{NodeID: "node2", Term: 8}}, "node1"},
+        {"other node holds the VIP", []leaderClaim{{NodeID: "node3", Term: 8, HoldsVIP: true}}, "node1"},
+        {"target holds the VIP", []leaderClaim{{NodeID: "node2", Term: 8, HoldsVIP: true}}, "node2"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            e := &Election{
+                cfg:      &config.Config{NodeID: "node1"},
+                group:    config.VIPGroup{Name: config.DefaultGroup},
+                leader:   "node1",
+                term:     7,
+                handover: &handover{target: "node2"},
+            }
+            got, _ := e.completeHandover(tt.claims, 8)
+            if got != tt.want {
+                t.Errorf("completeHandover() = %s, want %s", got, tt.want)
+            }
+            if completed := got == "node2"; e.handover.completed != completed {
+                t.Errorf("completed = %v, want %v", e.handover.completed, completed)
+            }
+        })
+    }
+}
+
+func TestHandOverForMaintenanceLogsOnce(t *testing.T) {
+    var out bytes.Buffer
+    log.SetOutput(&out)
+    defer log.SetOutput(os.Stderr)
+
+    e := &Election{
+        cfg:          &config.Config{NodeID: "node1"},
+        group:        config.VIPGroup{Name: config.DefaultGroup},
+        leader:       "node1",
+        lastDecision: Decision{Candidates: []NodeInfo{{NodeID: "node1", Healthy: true}}},
+        kick:         make(chan struct{}, 1),
+    }
+    for i := 0; i < 3; i++ {
+        e.handOverForMaintenance(true)
+    }
+    if n := strings.Count(out.String(), "cannot hand over"); n != 1 {
+        t.Errorf("logged %d times, want once:\n%s", n, out.String())
+    }
+
+    // Logged again once maintenance is left and entered again
+    e.handOverForMaintenance(false)
+    e.handOverForMaintenance(true)
+    if n := strings.Count(out.String(), "cannot hand over"); n != 2 {
+        t.Errorf("logged %d times after re-entering maintenance, want twice", n)
+    }
+
+    e.lastDecision.Candidates = append(e.lastDecision.Candidates, NodeInfo{NodeID: "node2", Healthy: true})
+    e.handOverForMaintenance(true)
+    if e.handover == nil || e.handover.target != "node2" || e.maintenanceError != "" {
+        t.Errorf("handover = %+v, maintenanceError = %q, want a handover to node2", e.handover, e.maintenanceError)
+    }
+}
+
+func TestStepDown(t *testing.T) {
+    newLeader := func() *Election {
+        return &Election{
+            cfg:    &config.Config{NodeID: "node1"},
+            group:  config.VIPGroup{Name: config.DefaultGroup},
+            leader: "node1",
+            lastDecision: Decision{Candidates: []NodeInfo{
+                {NodeID: "node1", Healthy: true}, {NodeID: "node2", Healthy: true}}},
+            kick: make(chan struct{}, 1),
+        }
+    }
+
+    t.Run("not the leader", func(t *testing.T) {
+        e := newLeader()
+        e.leader = "node2"
+        if err := e.StepDown(time.Second); err != nil || e.handover != nil {
+            t.Errorf("StepDown() = %v, handover = %+v, want nothing to do", err, e.handover)
+        }
+    })
+
+    t.Run("successor takes over", func(t *testing.T) {
+        e := newLeader()
+        go func() {
+            <-e.kick
+            e.mu.Lock()
+            e.leader = "node2"
+            e.mu.Unlock()
+        }()
+        if err := e.StepDown(5 * time.Second); err != nil {
+            t.Errorf("StepDown() = %v", err)
+        }
+    })
+
+    t.Run("no successor within the timeout", func(t *testing.T) {
+        e := newLeader()
+        if err := e.StepDown(200 * time.Millisecond); err == nil {
+            t.Error("StepDown() succeeded without a successor")
+        }
+    })
+
+    t.Run("handover outlasts the manual failover timeout", func(t *testing.T) {
+        e := newLeader()
+        go e.StepDown(time.Minute)
+        <-e.kick
+
+        // Evaluations after the 15 seconds a manual failover waits keep the
+        // handover for the whole shutdown timeout
+        e.mu.Lock()
+        e.handover.started = time.Now().Add(-handoverTimeout - time.Second)
+        e.mu.Unlock()
+        e.expireHandover()
+        e.mu.RLock()
+        kept := e.handover != nil
+        e.mu.RUnlock()
+        if !kept {
+            t.Fatal("handover abandoned after 16s of a 1m timeout")
+        }
+
+        e.mu.Lock()
+        e.handover.started = time.Now().Add(-time.Minute - time.Second)
+        e.leader = "node2" // Lets StepDown return
+        e.mu.Unlock()
+        e.expireHandover()
+        if e.handover != nil {
+            t.Error("handover kept beyond the timeout")
+        }
+    })
+}
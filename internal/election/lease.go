@@ -0,0 +1,406 @@
+package election
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "sync"
+    "time"
+
+    "github.com/2bleere/ha-vip/internal/config"
+    "github.com/2bleere/ha-vip/internal/metrics"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/tools/leaderelection"
+    "k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// Defaults for the Lease of the lease election backend
+const (
+    defaultLeaseName      = "ha-vip"
+    defaultLeaseNamespace = "kube-system"
+)
+
+// LeaseStatus describes the Lease of a group that uses the lease backend
+type LeaseStatus struct {
+    Name      string    `json:"name"`
+    Namespace string    `json:"namespace"`
+    Holder    string    `json:"holder"`
+    Available bool      `json:"available"` // False while the heartbeat election decides instead
+    Candidate bool      `json:"candidate"` // Whether this node campaigns for the Lease
+    Leading   bool      `json:"leading"`
+    LastRead  time.Time `json:"last_read,omitempty"`
+    LastError string    `json:"last_error,omitempty"`
+}
+
+// leaseElection decides the leader of a group through a Kubernetes Lease.
+// While this node is a candidate it campaigns for the Lease with client-go
+// leader election; either way it reads the Lease to follow its holder. When
+// the Lease cannot be read for a lease duration, the heartbeat election
+// takes over until it can be read again.
+type leaseElection struct {
+    e             *Election
+    client        func() kubernetes.Interface // Changes when the credentials are reloaded
+    name          string
+    namespace     string
+    leaseDuration time.Duration
+    renewDeadline time.Duration
+    retryPeriod   time.Duration
+
+    mu         sync.Mutex
+    cancel     context.CancelFunc // Stops the campaign in progress
+    done       chan struct{}      // Closed when the campaign has stopped
+    stopped    bool               // The election was stopped; do not campaign again
+    leading    bool
+    holder     string
+    renewTime  time.Time // Renew time of the Lease as last read
+    observedAt time.Time // When the holder or renew time last changed
+    reported   string    // Holder in effect after the last read
+    lastRead   time.Time // Last successful read of the Lease
+    readErr    error
+    available  bool
+}
+
+// newLeaseElection sets up the Lease of the group, or returns nil when the
+// group uses the heartbeat election
+func newLeaseElection(e *Election) *leaseElection {
+    if e.cfg.ElectionBackend != "lease" {
+        return nil
+    }
+    if e.k8sChecker == nil {
+        log.Printf("Election: Group %s - the Kubernetes client is not available, using the heartbeat election", e.group.Name)
+        return nil
+    }
+
+    name := e.cfg.Lease.Name
+    if name == "" {
+        name = defaultLeaseName
+    }
+    if e.group.Name != config.DefaultGroup {
+        name += "-" + e.group.Name
+    }
+    namespace := e.cfg.Lease.Namespace
+    if namespace == "" {
+        namespace = defaultLeaseNamespace
+    }
+    leaseDuration, renewDeadline, retryPeriod := e.cfg.LeaseDurations()
+    return &leaseElection{
+        e:             e,
+        client:        e.k8sChecker.Client,
+        name:          name,
+        namespace:     namespace,
+        leaseDuration: leaseDuration,
+        renewDeadline: renewDeadline,
+        retryPeriod:   retryPeriod,
+    }
+}
+
+func (l *leaseElection) ref() string {
+    return l.namespace + "/" + l.name
+}
+
+// run reads the Lease every retry period until stopCh is closed
+func (l *leaseElection) run(stopCh <-chan struct{}) {
+    ticker := time.NewTicker(l.retryPeriod)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ticker.C:
+            if l.read() {
+                l.kick()
+            }
+        case <-stopCh:
+            return
+        }
+    }
+}
+
+// read fetches the Lease and reports whether the holder or the
+// availability of the Lease changed
+func (l *leaseElection) read() bool {
+    ctx, cancel := context.WithTimeout(context.Background(), l.retryPeriod)
+    defer cancel()
+    lease, err := l.client().CoordinationV1().Leases(l.namespace).Get(ctx, l.name, metav1.GetOptions{})
+
+    holder := ""
+    var renewTime time.Time
+    if err == nil {
+        if lease.Spec.HolderIdentity != nil {
+            holder = *lease.Spec.HolderIdentity
+        }
+        if lease.Spec.RenewTime != nil {
+            renewTime = lease.Spec.RenewTime.Time
+        }
+    } else if apierrors.IsNotFound(err) {
+        // Nobody has held the Lease yet
+        err = nil
+    }
+    return l.observe(holder, renewTime, err, time.Now())
+}
+
+// observe records the result of reading the Lease at now and reports
+// whether the holder or the availability of the Lease changed
+func (l *leaseElection) observe(holder string, renewTime time.Time, err error, now time.Time) bool {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    wasAvailable := l.available
+    l.readErr = err
+    if err == nil {
+        l.lastRead = now
+        // Renewals made while the Lease was unavailable were not seen, so
+        // its expiry is measured afresh, as by a node that just started
+        if holder != l.holder || !renewTime.Equal(l.renewTime) || !wasAvailable {
+            l.holder = holder
+            l.renewTime = renewTime
+            l.observedAt = now
+        }
+    }
+    l.available = !l.lastRead.IsZero() && now.Sub(l.lastRead) < l.leaseDuration
+    metrics.LeaseAvailable.SetBool(l.available, l.e.group.Name)
+
+    switch {
+    case l.available && !wasAvailable:
+        log.Printf("Election: Group %s - following Lease %s (holder: %s)", l.e.group.Name, l.ref(), displayLeader(holder))
+    case !l.available && wasAvailable:
+        log.Printf("Election: Group %s - Lease %s unreadable for %v, falling back to the heartbeat election: %v",
+            l.e.group.Name, l.ref(), l.leaseDuration, err)
+    }
+    // Compared with the previous read, so a holder whose lease expired in
+    // between counts as a change too
+    previousHolder := l.reported
+    l.reported = l.currentHolderLocked(now)
+    return l.available != wasAvailable || l.reported != previousHolder
+}
+
+// currentHolderLocked returns the holder of the Lease if its lease has not
+// expired. As in client-go, expiry is measured from when this node last saw
+// the Lease change, so clock skew between nodes does not matter. While the
+// Lease cannot be read its renewals cannot be seen either, so the last
+// holder is kept until the heartbeat election takes over.
+func (l *leaseElection) currentHolderLocked(now time.Time) string {
+    if l.holder == "" || (l.readErr == nil && now.Sub(l.observedAt) >= l.leaseDuration) {
+        return ""
+    }
+    return l.holder
+}
+
+// leader returns the node the Lease makes leader, and false when the Lease
+// is unavailable and the heartbeat election has to decide. A nil
+// leaseElection never decides.
+func (l *leaseElection) leader() (string, bool) {
+    if l == nil {
+        return "", false
+    }
+
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if !l.available {
+        return "", false
+    }
+    if l.leading {
+        return l.e.cfg.NodeID, true
+    }
+    // Our own name as holder is a Lease we failed to renew, which the other
+    // nodes follow until it expires, or, once we stopped campaigning, one we
+    // released
+    holder := l.currentHolderLocked(time.Now())
+    if holder == l.e.cfg.NodeID && l.cancel == nil {
+        return "", true
+    }
+    return holder, true
+}
+
+// setCandidate starts or stops campaigning for the Lease. Stopping a
+// campaign releases the Lease if this node holds it.
+func (l *leaseElection) setCandidate(candidate bool) {
+    if l == nil {
+        return
+    }
+
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    switch {
+    case candidate && l.cancel == nil && !l.stopped:
+        ctx, cancel := context.WithCancel(context.Background())
+        l.cancel = cancel
+        l.done = make(chan struct{})
+        go l.campaign(ctx, l.done)
+        log.Printf("Election: Group %s - campaigning for Lease %s", l.e.group.Name, l.ref())
+    case !candidate && l.cancel != nil:
+        l.cancel()
+        l.cancel = nil
+        log.Printf("Election: Group %s - no longer campaigning for Lease %s", l.e.group.Name, l.ref())
+    }
+}
+
+// campaign runs client-go leader election until ctx is cancelled, starting
+// over whenever leadership is lost
+func (l *leaseElection) campaign(ctx context.Context, done chan struct{}) {
+    defer close(done)
+    for ctx.Err() == nil {
+        // Built for every round, so that reloaded credentials are used
+        lock := &resourcelock.LeaseLock{
+            LeaseMeta:  metav1.ObjectMeta{Name: l.name, Namespace: l.namespace},
+            Client:     l.client().CoordinationV1(),
+            LockConfig: resourcelock.ResourceLockConfig{Identity: l.e.cfg.NodeID},
+        }
+        elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+            Lock:            lock,
+            Name:            l.ref(),
+            LeaseDuration:   l.leaseDuration,
+            RenewDeadline:   l.renewDeadline,
+            RetryPeriod:     l.retryPeriod,
+            ReleaseOnCancel: true,
+            Callbacks: leaderelection.LeaderCallbacks{
+                OnStartedLeading: func(context.Context) { l.setLeading(true) },
+                OnStoppedLeading: func() { l.setLeading(false) },
+            },
+        })
+        if err != nil {
+            log.Printf("Election: Group %s - cannot campaign for Lease %s: %v", l.e.group.Name, l.ref(), err)
+            return
+        }
+        elector.Run(ctx)
+
+        select {
+        case <-time.After(l.retryPeriod):
+        case <-ctx.Done():
+        }
+    }
+}
+
+// setLeading records whether this node holds the Lease and re-evaluates
+// the election at once
+func (l *leaseElection) setLeading(leading bool) {
+    l.mu.Lock()
+    changed := l.leading != leading
+    l.leading = leading
+    if leading {
+        l.holder = l.e.cfg.NodeID
+        l.observedAt = time.Now()
+    }
+    l.mu.Unlock()
+
+    // client-go also reports stopping when a campaign ends without leading
+    if !changed {
+        return
+    }
+    if leading {
+        log.Printf("Election: Group %s - acquired Lease %s", l.e.group.Name, l.ref())
+    } else {
+        log.Printf("Election: Group %s - lost or released Lease %s", l.e.group.Name, l.ref())
+    }
+    l.kick()
+}
+
+// stop ends the campaign and waits a renew deadline at most for the Lease
+// to be released
+func (l *leaseElection) stop() {
+    if l == nil {
+        return
+    }
+
+    l.mu.Lock()
+    done := l.done
+    l.stopped = true
+    l.mu.Unlock()
+    l.setCandidate(false)
+    if done == nil {
+        return
+    }
+    select {
+    case <-done:
+    case <-time.After(l.renewDeadline):
+        log.Printf("Election: Group %s - timed out releasing Lease %s", l.e.group.Name, l.ref())
+    }
+}
+
+func (l *leaseElection) kick() {
+    select {
+    case l.e.kick <- struct{}{}:
+    default:
+    }
+}
+
+func (l *leaseElection) status() *LeaseStatus {
+    if l == nil {
+        return nil
+    }
+
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    status := &LeaseStatus{
+        Name:      l.name,
+        Namespace: l.namespace,
+        Holder:    l.currentHolderLocked(time.Now()),
+        Available: l.available,
+        Candidate: l.cancel != nil,
+        Leading:   l.leading,
+        LastRead:  l.lastRead,
+    }
+    if l.readErr != nil {
+        status.LastError = l.readErr.Error()
+    }
+    return status
+}
+
+// leaseCandidate reports whether this node should campaign for the Lease.
+// Like the heartbeat election it leaves the Lease to healthy nodes while
+// there are any, and never campaigns in maintenance mode or while a manual
+// failover hands leadership to another node. A Lease is never taken from
+// its holder, so a handover only holds other candidates back while its
+// target is there to acquire the Lease and does not hold it yet.
+func (e *Election) leaseCandidate(nodes []NodeInfo) bool {
+    local := nodes[0]
+    e.mu.RLock()
+    handingOver := e.handover != nil && !e.handover.completed
+    e.mu.RUnlock()
+    if local.Maintenance || handingOver {
+        return false
+    }
+    if target := e.handoverTo; target != "" && target != e.cfg.NodeID {
+        holder, _ := e.lease.leader()
+        for _, node := range nodes[1:] {
+            if node.NodeID == target && node.Healthy && holder != target {
+                return false
+            }
+        }
+    }
+    if local.Healthy {
+        return true
+    }
+    for _, node := range nodes[1:] {
+        if node.Healthy && !node.Maintenance {
+            return false
+        }
+    }
+    return true
+}
+
+// selectLeaseLeader picks the leader when the Lease decides: its holder,
+// or, while this node hands the Lease over, the handover target until it
+// has acquired it
+func (e *Election) selectLeaseLeader(holder string) string {
+    if holder != "" {
+        e.decide("holder of Lease %s", e.lease.ref())
+        return holder
+    }
+
+    e.mu.RLock()
+    defer e.mu.RUnlock()
+    if e.handover != nil && e.leader == e.cfg.NodeID {
+        e.decide("handing over to %s, waiting for it to acquire Lease %s", e.handover.target, e.lease.ref())
+        return e.handover.target
+    }
+    e.decide("Lease %s has no holder", e.lease.ref())
+    return ""
+}
+
+// leaseFallback prefixes the reason of a heartbeat election that stands in
+// for an unavailable Lease
+func (e *Election) leaseFallback() {
+    if e.lease != nil {
+        e.decision = fmt.Sprintf("Lease %s unavailable, %s", e.lease.ref(), e.decision)
+    }
+}
@@ -0,0 +1,184 @@
+package election
+
+import (
+    "errors"
+    "strings"
+    "testing"
+    "time"
+
+    coordinationv1 "k8s.io/api/coordination/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/kubernetes/fake"
+    k8stesting "k8s.io/client-go/testing"
+
+    "github.com/2bleere/ha-vip/internal/config"
+)
+
+func TestLeaseFallbackTiming(t *testing.T) {
+    e := newTestElection("node1", 1, 0)
+    l := &leaseElection{
+        e:             e,
+        name:          defaultLeaseName,
+        namespace:     defaultLeaseNamespace,
+        leaseDuration: 15 * time.Second,
+        renewDeadline: 10 * time.Second,
+        retryPeriod:   2 * time.Second,
+    }
+    e.lease = l
+
+    start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+    renewed := start.Add(-time.Second)
+    renewedAgain := start.Add(17 * time.Second)
+    unreachable := errors.New("connection refused")
+
+    steps := []struct {
+        name          string
+        at            time.Duration
+        renewTime     time.Time
+        err           error
+        wantChanged   bool
+        wantAvailable bool
+        wantHolder    string
+    }{
+        {"first read follows the holder", 0, renewed, nil, true, true, "node2"},
+        {"unchanged Lease", 5 * time.Second, renewed, nil, false, true, "node2"},
+        {"holder expires without renewals", 16 * time.Second, renewed, nil, true, true, ""},
+        {"renewal brings the holder back", 17 * time.Second, renewedAgain, nil, true, true, "node2"},
+        {"read error keeps the holder", 20 * time.Second, time.Time{}, unreachable, false, true, "node2"},
+        {"still available within a lease duration", 31 * time.Second, time.Time{}, unreachable, false, true, "node2"},
+        {"falls back after a lease duration", 33 * time.Second, time.Time{}, unreachable, true, false, "node2"},
+        {"readable again", 34 * time.Second, renewedAgain, nil, true, true, "node2"},
+        {"expiry measured afresh after fallback", 48 * time.Second, renewedAgain, nil, false, true, "node2"},
+        {"holder expires again", 50 * time.Second, renewedAgain, nil, true, true, ""},
+    }
+    for _, step := range steps {
+        now := start.Add(step.at)
+        holder := ""
+        if step.err == nil {
+            holder = "node2"
+        }
+        changed := l.observe(holder, step.renewTime, step.err, now)
+        if changed != step.wantChanged || l.available != step.wantAvailable || l.currentHolderLocked(now) != step.wantHolder {
+            t.Fatalf("%s (at %v): changed=%v available=%v holder=%q, want changed=%v available=%v holder=%q",
+                step.name, step.at, changed, l.available, l.currentHolderLocked(now),
+                step.wantChanged, step.wantAvailable, step.wantHolder)
+        }
+    }
+}
+
+func TestLeaseLeader(t *testing.T) {
+    var none *leaseElection
+    if _, ok := none.leader(); ok {
+        t.Errorf("nil leaseElection decides, want the heartbeat election")
+    }
+
+    tests := []struct {
+        name       string
+        available  bool
+        leading    bool
+        holder     string
+        wantLeader string
+        wantOK     bool
+    }{
+        {"unavailable Lease", false, false, "node2", "", false},
+        {"follows the holder", true, false, "node2", "node2", true},
+        {"no holder", true, false, "", "", true},
+        {"leading", true, true, "node1", "node1", true},
+        {"own Lease no longer campaigned for", true, false, "node1", "", true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            l := &leaseElection{
+                e:             &Election{cfg: &config.Config{NodeID: "node1"}, group: config.VIPGroup{Name: config.DefaultGroup}},
+                leaseDuration: 15 * time.Second,
+                available:     tt.available,
+                leading:       tt.leading,
+                holder:        tt.holder,
+                observedAt:    time.Now(),
+            }
+            leader, ok := l.leader()
+            if leader != tt.wantLeader || ok != tt.wantOK {
+                t.Errorf("leader() = %q, %v, want %q, %v", leader, ok, tt.wantLeader, tt.wantOK)
+            }
+        })
+    }
+}
+
+func TestLeaseFallbackOnReadErrors(t *testing.T) {
+    holder := "node2"
+    client := fake.NewSimpleClientset(&coordinationv1.Lease{
+        ObjectMeta: metav1.ObjectMeta{Name: defaultLeaseName, Namespace: defaultLeaseNamespace},
+        Spec:       coordinationv1.LeaseSpec{HolderIdentity: &holder, RenewTime: &metav1.MicroTime{Time: time.Now()}},
+    })
+    failing := false
+    client.PrependReactor("get", "leases", func(k8stesting.Action) (bool, runtime.Object, error) {
+        if failing {
+            return true, nil, errors.New("connection refused")
+        }
+        return false, nil, nil
+    })
+
+    e := newTestElection("node1", 1, 0)
+    l := &leaseElection{
+        e:             e,
+        client:        func() kubernetes.Interface { return client },
+        name:          defaultLeaseName,
+        namespace:     defaultLeaseNamespace,
+        leaseDuration: 300 * time.Millisecond,
+        retryPeriod:   50 * time.Millisecond,
+    }
+    e.lease = l
+
+    if changed := l.read(); !changed {
+        t.Error("first read reported no change")
+    }
+    if leader, ok := l.leader(); leader != "node2" || !ok {
+        t.Fatalf("leader() = %q, %v, want node2 from the Lease", leader, ok)
+    }
+
+    lastRead := l.status().LastRead
+
+    failing = true
+    deadline := time.Now().Add(2 * l.leaseDuration)
+    for !l.read() {
+        if time.Now().After(deadline) {
+            t.Fatalf("still following the Lease after %v of read errors", 2*l.leaseDuration)
+        }
+        if leader, ok := l.leader(); leader != "node2" || !ok {
+            t.Fatalf("leader() = %q, %v within a lease duration of read errors, want node2", leader, ok)
+        }
+        time.Sleep(l.retryPeriod)
+    }
+    if elapsed := time.Since(lastRead); elapsed < l.leaseDuration {
+        t.Errorf("fell back %v after the last read, want at least %v", elapsed, l.leaseDuration)
+    }
+    if leader, ok := l.leader(); ok {
+        t.Fatalf("leader() = %q, %v after a lease duration of read errors, want the heartbeat election", leader, ok)
+    }
+    status := l.status()
+    if status.Available || status.LastError == "" {
+        t.Errorf("status = %+v, want unavailable with the read error", status)
+    }
+
+    // The heartbeat election decides and says why
+    e.decision = ""
+    nodes := []NodeInfo{{NodeID: "node1", Priority: 1, Healthy: true}, {NodeID: "node2", Priority: 2, Healthy: true}}
+    if leader := e.selectLeader(nodes); leader != "node1" {
+        t.Errorf("heartbeat election picked %s, want node1", leader)
+    }
+    e.leaseFallback()
+    if !strings.HasPrefix(e.decision, "Lease kube-system/ha-vip unavailable, ") {
+        t.Errorf("decision = %q, want the Lease fallback noted", e.decision)
+    }
+
+    failing = false
+    if changed := l.read(); !changed {
+        t.Error("readable Lease again reported no change")
+    }
+    if leader, ok := l.leader(); leader != "node2" || !ok {
+        t.Errorf("leader() = %q, %v once readable, want node2 from the Lease", leader, ok)
+    }
+}
+
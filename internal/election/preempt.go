@@ -0,0 +1,59 @@
+package election
+
+import (
+    "log"
+    "time"
+)
+
+// applyPreemption decides whether the best healthy node may take over from
+// the current leader. In nopreempt mode a healthy leader keeps the VIP
+// until it fails; with a preempt delay the better node must stay the best
+// candidate for that long before it takes over.
+func (e *Election) applyPreemption(best NodeInfo, healthyNodes []NodeInfo) string {
+    current := e.leader
+    if current == "" || current == best.NodeID || (!e.cfg.NoPreempt && e.cfg.PreemptDelay <= 0) {
+        e.preemptCandidate = ""
+        return best.NodeID
+    }
+
+    // Only a healthy current leader can hold on to the VIP
+    var currentNode *NodeInfo
+    for i := range healthyNodes {
+        if healthyNodes[i].NodeID == current {
+            currentNode = &healthyNodes[i]
+            break
+        }
+    }
+    if currentNode == nil {
+        e.preemptCandidate = ""
+        return best.NodeID
+    }
+
+    if e.cfg.NoPreempt {
+        e.decide("keeping healthy leader %s (priority %d) over %s (priority %d), nopreempt is set", 
+            current, currentNode.Priority, best.NodeID, best.Priority)
+        log.Printf("Election: Group %s - keeping leader %s (priority: %d), nopreempt is set (best candidate: %s, priority: %d)", 
+            e.group.Name, current, currentNode.Priority, best.NodeID, best.Priority)
+        return current
+    }
+
+    now := time.Now()
+    if e.preemptCandidate != best.NodeID {
+        e.preemptCandidate = best.NodeID
+        e.preemptSince = now
+    }
+
+    delay := time.Duration(e.cfg.PreemptDelay) * time.Second
+    if stable := now.Sub(e.preemptSince); stable < delay {
+        e.decide("keeping leader %s until %s has been the best candidate for %v (%v so far)", 
+            current, best.NodeID, delay, stable.Round(time.Second))
+        log.Printf("Election: Group %s - %s may preempt %s after %v more (stable for %v)", 
+            e.group.Name, best.NodeID, current, (delay - stable).Round(time.Second), stable.Round(time.Second))
+        return current
+    }
+
+    log.Printf("Election: Group %s - %s stable for %v, preempting %s", e.group.Name, best.NodeID, delay, current)
+    e.decide("%s preempted %s after being the best candidate for %v", best.NodeID, current, delay)
+    e.preemptCandidate = ""
+    return best.NodeID
+}
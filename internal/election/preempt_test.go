@@ -0,0 +1,48 @@
+package election
+
+import (
+    "testing"
+    "time"
+
+    "github.com/2bleere/ha-vip/internal/config"
+)
+
+func TestApplyPreemption(t *testing.T) {
+    best := NodeInfo{NodeID: "node1", Priority: 1, Healthy: true}
+    leader := NodeInfo{NodeID: "node2", Priority: 2, Healthy: true}
+
+    tests := []struct {
+        name         string
+        noPreempt    bool
+        preemptDelay int
+        leader       string
+        healthy      []NodeInfo
+        candidate    string        // Candidate already waiting to preempt
+        waited       time.Duration // How long it has been waiting
+        want         string
+    }{
+        {"preempts by default", false, 0, "node2", []NodeInfo{best, leader}, "", 0, "node1"},
+        {"no leader yet", true, 0, "", []NodeInfo{best, leader}, "", 0, "node1"},
+        {"nopreempt keeps a healthy leader", true, 0, "node2", []NodeInfo{best, leader}, "", 0, "node2"},
+        {"nopreempt replaces an unhealthy leader", true, 0, "node2", []NodeInfo{best}, "", 0, "node1"},
+        {"delay keeps the leader at first", false, 30, "node2", []NodeInfo{best, leader}, "", 0, "node2"},
+        {"delay keeps the leader while waiting", false, 30, "node2", []NodeInfo{best, leader}, "node1", 10 * time.Second, "node2"},
+        {"delay preempts once elapsed", false, 30, "node2", []NodeInfo{best, leader}, "node1", 31 * time.Second, "node1"},
+        {"delay restarts for a new candidate", false, 30, "node2", []NodeInfo{best, leader}, "node3", time.Minute, "node2"},
+        {"delay does not protect an unhealthy leader", false, 30, "node2", []NodeInfo{best}, "", 0, "node1"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            e := &Election{
+                cfg:              &config.Config{NodeID: "node1", NoPreempt: tt.noPreempt, PreemptDelay: tt.preemptDelay},
+                group:            config.VIPGroup{Name: config.DefaultGroup},
+                leader:           tt.leader,
+                preemptCandidate: tt.candidate,
+                preemptSince:     time.Now().Add(-tt.waited),
+            }
+            if got := e.applyPreemption(best, tt.healthy); got != tt.want {
+                t.Errorf("applyPreemption() = %s, want %s (decision: %s)", got, tt.want, e.decision)
+            }
+        })
+    }
+}
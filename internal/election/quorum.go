@@ -0,0 +1,92 @@
+package election
+
+import (
+    "log"
+    "net"
+
+    "github.com/2bleere/ha-vip/internal/heartbeat"
+)
+
+// QuorumStatus describes how much of the configured cluster this node can
+// currently see.
+type QuorumStatus struct {
+    Enabled   bool `json:"enabled"`
+    HasQuorum bool `json:"has_quorum"`
+    Visible   int  `json:"visible"` // Live nodes including this one
+    Total     int  `json:"total"`   // Configured peers plus this node
+}
+
+// checkQuorum counts this node plus every configured peer that is sending
+// heartbeats for this group against the configured cluster size. Nodes
+// missing from peers never count, so they cannot lend a minority quorum.
+// Without quorum mode the node always has quorum.
+func (e *Election) checkQuorum(peers map[string]heartbeat.PeerInfo) QuorumStatus {
+    live := make(map[string]bool, len(peers))
+    for _, info := range peers {
+        if _, ok := info.Group(e.group.Name); ok {
+            live[info.Address] = true
+        }
+    }
+
+    total := len(e.cfg.Peers) + 1
+    visible := 1
+    for _, peer := range e.cfg.Peers {
+        for _, address := range peerAddresses(peer) {
+            if live[address] {
+                visible++
+                break
+            }
+        }
+    }
+
+    status := QuorumStatus{
+        Enabled:   e.cfg.Quorum,
+        HasQuorum: true,
+        Visible:   visible,
+        Total:     total,
+    }
+    if e.cfg.Quorum {
+        // Strict majority, so two halves of a partition can never both win
+        status.HasQuorum = visible*2 > total
+    }
+    return status
+}
+
+// peerAddresses returns the IP addresses a configured peer sends from,
+// resolving it when it is given as a host name
+func peerAddresses(peer string) []string {
+    host, _, err := net.SplitHostPort(peer)
+    if err != nil {
+        host = peer
+    }
+    if ip := net.ParseIP(host); ip != nil {
+        return []string{ip.String()}
+    }
+    addresses, _ := net.LookupHost(host)
+    return addresses
+}
+
+// updateQuorum records the latest quorum status and logs transitions
+func (e *Election) updateQuorum(status QuorumStatus) {
+    e.mu.Lock()
+    previous := e.quorum
+    e.quorum = status
+    e.mu.Unlock()
+
+    if !status.Enabled || (previous.HasQuorum == status.HasQuorum && previous.Total != 0) {
+        return
+    }
+    if status.HasQuorum {
+        log.Printf("Election: Quorum established for group %s (%d/%d nodes visible)", e.group.Name, status.Visible, status.Total)
+    } else {
+        log.Printf("Election: Quorum lost for group %s (%d/%d nodes visible, need %d) - refusing leadership", 
+            e.group.Name, status.Visible, status.Total, status.Total/2+1)
+    }
+}
+
+// GetQuorumStatus returns the quorum status from the latest evaluation
+func (e *Election) GetQuorumStatus() QuorumStatus {
+    e.mu.RLock()
+    defer e.mu.RUnlock()
+    return e.quorum
+}
@@ -0,0 +1,106 @@
+package election
+
+import (
+    "fmt"
+    "testing"
+    "time"
+
+    "github.com/2bleere/ha-vip/internal/config"
+    "github.com/2bleere/ha-vip/internal/heartbeat"
+)
+
+// livePeers returns n configured peers as GetPeers would report them
+func livePeers(n int) map[string]heartbeat.PeerInfo {
+    peers := make(map[string]heartbeat.PeerInfo, n)
+    for i := 0; i < n; i++ {
+        peers[fmt.Sprintf("node%d", i+2)] = heartbeat.PeerInfo{
+            Address:  fmt.Sprintf("10.0.0.%d", i+2),
+            LastSeen: time.Now(),
+            Healthy:  true,
+        }
+    }
+    return peers
+}
+
+func TestCheckQuorum(t *testing.T) {
+    tests := []struct {
+        name       string
+        quorum     bool
+        configured int // Configured peers, excluding this node
+        live       int // Peers currently heard from
+        want       QuorumStatus
+    }{
+        {"disabled always has quorum", false, 2, 0, QuorumStatus{Enabled: false, HasQuorum: true, Visible: 1, Total: 3}},
+        {"single node", true, 0, 0, QuorumStatus{Enabled: true, HasQuorum: true, Visible: 1, Total: 1}},
+        {"two of three", true, 2, 1, QuorumStatus{Enabled: true, HasQuorum: true, Visible: 2, Total: 3}},
+        {"one of three", true, 2, 0, QuorumStatus{Enabled: true, HasQuorum: false, Visible: 1, Total: 3}},
+        {"half of four is not a majority", true, 3, 1, QuorumStatus{Enabled: true, HasQuorum: false, Visible: 2, Total: 4}},
+        {"three of four", true, 3, 2, QuorumStatus{Enabled: true, HasQuorum: true, Visible: 3, Total: 4}},
+        {"one of two", true, 1, 0, QuorumStatus{Enabled: true, HasQuorum: false, Visible: 1, Total: 2}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg := &config.Config{NodeID: "node1", Quorum: tt.quorum}
+            for i := 0; i < tt.configured; i++ {
+                cfg.Peers = append(cfg.Peers, fmt.Sprintf("10.0.0.%d:9999", i+2))
+            }
+            e := &Election{cfg: cfg, group: config.VIPGroup{Name: config.DefaultGroup}}
+            if got := e.checkQuorum(livePeers(tt.live)); got != tt.want {
+                t.Errorf("checkQuorum() = %+v, want %+v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestCheckQuorumIgnoresForeignPeers(t *testing.T) {
+    cfg := &config.Config{NodeID: "node1", Quorum: true, Peers: []string{"10.0.0.2:9999", "10.0.0.3:9999"}}
+    e := &Election{cfg: cfg, group: config.VIPGroup{Name: "api"}}
+    member := map[string]heartbeat.GroupState{"api": {Priority: 1, Healthy: true}}
+    other := map[string]heartbeat.GroupState{"ingress": {Priority: 1, Healthy: true}}
+
+    tests := []struct {
+        name  string
+        peers map[string]heartbeat.PeerInfo
+        want  bool
+    }{
+        {"unknown peer", map[string]heartbeat.PeerInfo{
+            "rogue": {Address: "10.0.0.99", Groups: member}}, false},
+        {"unknown peer claiming a configured node's ID", map[string]heartbeat.PeerInfo{
+            "node2": {Address: "10.0.0.99", Groups: member}}, false},
+        {"configured peer outside the group", map[string]heartbeat.PeerInfo{
+            "node2": {Address: "10.0.0.2", Groups: other}}, false},
+        {"two IDs from one configured peer", map[string]heartbeat.PeerInfo{
+            "node2": {Address: "10.0.0.2", Groups: member}, "node2b": {Address: "10.0.0.2", Groups: member}}, true},
+        {"configured member", map[string]heartbeat.PeerInfo{
+            "node2": {Address: "10.0.0.2", Groups: member}, "rogue": {Address: "10.0.0.99", Groups: member}}, true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := e.checkQuorum(tt.peers)
+            if got.HasQuorum != tt.want {
+                t.Errorf("checkQuorum() = %+v, want HasQuorum %v", got, tt.want)
+            }
+            if got.Visible > 2 {
+                t.Errorf("checkQuorum() Visible = %d, a single configured peer counts once", got.Visible)
+            }
+        })
+    }
+}
+
+func TestPeerAddresses(t *testing.T) {
+    tests := []struct {
+        peer string
+        want string
+    }{
+        {"10.0.0.2:9999", "10.0.0.2"},
+        {"10.0.0.2", "10.0.0.2"},
+        {"[fd00:10::11]:9999", "fd00:10::11"},
+        {"[FD00:10:0::11]:9999", "fd00:10::11"},
+    }
+    for _, tt := range tests {
+        got := peerAddresses(tt.peer)
+        if len(got) != 1 || got[0] != tt.want {
+            t.Errorf("peerAddresses(%q) = %v, want [%s]", tt.peer, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,48 @@
+package election
+
+import (
+    "time"
+)
+
+// Decision records the outcome of an election evaluation and why that
+// leader was chosen
+type Decision struct {
+    Leader     string     `json:"leader"`
+    Term       uint64     `json:"term"`
+    Reason     string     `json:"reason"`
+    Time       time.Time  `json:"time"`       // When the evaluation ran
+    ChangedAt  time.Time  `json:"changed_at"` // When the leader last changed
+    Candidates []NodeInfo `json:"candidates"`
+}
+
+// Status is a snapshot of the election of one VIP group
+type Status struct {
+    Group    string          `json:"group"`
+    Leader   string          `json:"leader"`
+    IsLeader bool            `json:"is_leader"`
+    Term     uint64          `json:"term"`
+    Quorum   QuorumStatus    `json:"quorum"`
+    Decision Decision        `json:"last_decision"`
+    Handover *HandoverStatus `json:"handover,omitempty"`
+    Lease    *LeaseStatus    `json:"lease,omitempty"`
+}
+
+// Status returns the current leader of the group and the reasoning behind
+// the latest evaluation
+func (e *Election) Status() Status {
+    e.mu.RLock()
+    defer e.mu.RUnlock()
+
+    decision := e.lastDecision
+    decision.Candidates = append([]NodeInfo(nil), decision.Candidates...)
+    return Status{
+        Group:    e.group.Name,
+        Leader:   e.leader,
+        IsLeader: e.leader == e.cfg.NodeID,
+        Term:     e.term,
+        Quorum:   e.quorum,
+        Decision: decision,
+        Handover: e.handoverStatus(),
+        Lease:    e.lease.status(),
+    }
+}
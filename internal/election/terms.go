@@ -0,0 +1,123 @@
+package election
+
+import (
+    "log"
+    "sort"
+
+    "github.com/2bleere/ha-vip/internal/heartbeat"
+)
+
+// leaderClaim is a node claiming leadership of the group in a given term
+type leaderClaim struct {
+    NodeID   string
+    Term     uint64
+    Priority int
+    Handover string // Node the claimant is handing leadership to
+    HoldsVIP bool
+}
+
+// beats reports whether claim c wins over claim o. Higher terms win; within
+// a term the better priority (lower number) wins, then the lower node ID.
+func (c leaderClaim) beats(o leaderClaim) bool {
+    if c.Term != o.Term {
+        return c.Term > o.Term
+    }
+    if c.Priority != o.Priority {
+        return c.Priority < o.Priority
+    }
+    return c.NodeID < o.NodeID
+}
+
+// peerClaims returns the peers currently claiming leadership of the group,
+// strongest claim first, and the highest term any peer has advertised.
+func (e *Election) peerClaims(peers map[string]heartbeat.PeerInfo) ([]leaderClaim, uint64) {
+    var claims []leaderClaim
+    var maxTerm uint64
+    for peer, peerInfo := range peers {
+        state, ok := peerInfo.Group(e.group.Name)
+        if !ok {
+            continue
+        }
+        if state.Term > maxTerm {
+            maxTerm = state.Term
+        }
+        if state.Leader == peer {
+            claims = append(claims, leaderClaim{
+                NodeID:   peer,
+                Term:     state.Term,
+                Priority: state.Priority,
+                Handover: state.Handover,
+                HoldsVIP: state.HoldsVIP,
+            })
+        }
+    }
+    // Peers arrive in map order; every node must weigh conflicting claims
+    // the same way to converge on one leader
+    sort.Slice(claims, func(i, j int) bool {
+        return claims[i].beats(claims[j])
+    })
+    return claims, maxTerm
+}
+
+// resolveTerm reconciles the locally selected leader with the claims peers
+// advertise and returns the leader to act on and the local term.
+//
+// A node never takes over from a peer that is still claiming leadership; it
+// waits until that peer stands down, so the VIP is not held twice. If two
+// nodes already both claim leadership (for example after a partition heals)
+// the stronger claim wins and the other node releases the VIP immediately.
+func (e *Election) resolveTerm(selected, current string, term uint64, peers map[string]heartbeat.PeerInfo) (string, uint64) {
+    claims, maxTerm := e.peerClaims(peers)
+    if maxTerm > term {
+        term = maxTerm
+    }
+
+    // Keep the VIP during a manual failover until the target holds it
+    if current == e.cfg.NodeID && e.handover != nil && selected == e.handover.target {
+        return e.completeHandover(claims, term)
+    }
+
+    if selected != e.cfg.NodeID {
+        return selected, term
+    }
+
+    if current != e.cfg.NodeID {
+        // Defer to the strongest peer that still claims leadership, unless
+        // it is handing leadership to us
+        for _, claim := range claims {
+            if claim.Handover == e.cfg.NodeID {
+                continue
+            }
+            log.Printf("Election: Group %s - waiting for %s (term %d) to stand down before taking over", 
+                e.group.Name, claim.NodeID, claim.Term)
+            e.decide("waiting for %s (term %d) to stand down before taking over", claim.NodeID, claim.Term)
+            return claim.NodeID, term
+        }
+        // Start a new term for our own leadership
+        e.decide("%s, starting term %d", e.decision, term+1)
+        return selected, term + 1
+    }
+
+    // We already lead; step down if a peer holds a stronger claim
+    ours := leaderClaim{NodeID: e.cfg.NodeID, Term: e.term, Priority: e.effectivePriority()}
+    for _, claim := range claims {
+        if claim.Handover == e.cfg.NodeID {
+            // The previous leader keeps claiming until it sees us hold the VIP
+            continue
+        }
+        if claim.beats(ours) {
+            log.Printf("Election: Group %s - conflicting leader %s (term %d) beats our claim (term %d), stepping down", 
+                e.group.Name, claim.NodeID, claim.Term, e.term)
+            e.decide("conflicting leader %s (term %d) beats our claim (term %d)", claim.NodeID, claim.Term, e.term)
+            return claim.NodeID, term
+        }
+    }
+    return selected, e.term
+}
+
+// GetTerm returns the current election term of the group
+func (e *Election) GetTerm() uint64 {
+    e.mu.RLock()
+    defer e.mu.RUnlock()
+    return e.term
+}
@@ -0,0 +1,173 @@
+package election
+
+import (
+    "testing"
+
+    "github.com/2bleere/ha-vip/internal/config"
+    "github.com/2bleere/ha-vip/internal/heartbeat"
+)
+
+func TestLeaderClaimBeats(t *testing.T) {
+    tests := []struct {
+        name string
+        c, o leaderClaim
+        want bool
+    }{
+        {"higher term wins", leaderClaim{NodeID: "b", Term: 5, Priority: 9}, leaderClaim{NodeID: "a", Term: 4, Priority: 1}, true},
+        {"lower term loses", leaderClaim{NodeID: "a", Term: 4, Priority: 1}, leaderClaim{NodeID: "b", Term: 5, Priority: 9}, false},
+        {"better priority wins within a term", leaderClaim{NodeID: "b", Term: 3, Priority: 1}, leaderClaim{NodeID: "a", Term: 3, Priority: 2}, true},
+        {"worse priority loses within a term", leaderClaim{NodeID: "a", Term: 3, Priority: 2}, leaderClaim{NodeID: "b", Term: 3, Priority: 1}, false},
+        {"lower node ID breaks ties", leaderClaim{NodeID: "a", Term: 3, Priority: 1}, leaderClaim{NodeID: "b", Term: 3, Priority: 1}, true},
+        {"higher node ID loses ties", leaderClaim{NodeID: "b", Term: 3, Priority: 1}, leaderClaim{NodeID: "a", Term: 3, Priority: 1}, false},
+        {"a claim does not beat itself", leaderClaim{NodeID: "a", Term: 3, Priority: 1}, leaderClaim{NodeID: "a", Term: 3, Priority: 1}, false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := tt.c.beats(tt.o); got != tt.want {
+                t.Errorf("%+v.beats(%+v) = %v, want %v", tt.c, tt.o, got, tt.want)
+            }
+        })
+    }
+}
+
+// claiming returns a peer that claims leadership of the default group
+func claiming(nodeID string, term uint64, priority int) heartbeat.PeerInfo {
+    return heartbeat.PeerInfo{Groups: map[string]heartbeat.GroupState{
+        config.DefaultGroup: {Priority: priority, Healthy: true, Term: term, Leader: nodeID},
+    }}
+}
+
+// following returns a peer that recognises leader in the default group
+func following(leader string, term uint64, priority int) heartbeat.PeerInfo {
+    return heartbeat.PeerInfo{Groups: map[string]heartbeat.GroupState{
+        config.DefaultGroup: {Priority: priority, Healthy: true, Term: term, Leader: leader},
+    }}
+}
+
+func newTestElection(nodeID string, priority int, term uint64) *Election {
+    return &Election{
+        cfg:   &config.Config{NodeID: nodeID},
+        group: config.VIPGroup{Name: config.DefaultGroup, Priority: priority},
+        term:  term,
+    }
+}
+
+func TestResolveTerm(t *testing.T) {
+    handingToLocal := claiming("node2", 4, 2)
+    state := handingToLocal.Groups[config.DefaultGroup]
+    state.Handover = "node1"
+    handingToLocal.Groups[config.DefaultGroup] = state
+
+    tests := []struct {
+        name       string
+        selected   string
+        current    string
+        term       uint64
+        peers      map[string]heartbeat.PeerInfo
+        wantLeader string
+        wantTerm   uint64
+    }{
+        {
+            name:       "follows a selected peer and adopts the highest term",
+            selected:   "node2",
+            current:    "node2",
+            term:       3,
+            peers:      map[string]heartbeat.PeerInfo{"node2": claiming("node2", 5, 2)},
+            wantLeader: "node2",
+            wantTerm:   5,
+        },
+        {
+            name:       "starts a new term when nobody claims leadership",
+            selected:   "node1",
+            current:    "",
+            term:       3,
+            peers:      map[string]heartbeat.PeerInfo{"node2": following("", 4, 2)},
+            wantLeader: "node1",
+            wantTerm:   5,
+        },
+        {
+            name:       "waits for a claiming peer to stand down",
+            selected:   "node1",
+            current:    "node2",
+            term:       4,
+            peers:      map[string]heartbeat.PeerInfo{"node2": claiming("node2", 4, 2)},
+            wantLeader: "node2",
+            wantTerm:   4,
+        },
+        {
+            name:     "waits for the strongest of several claiming peers",
+            selected: "node1",
+            current:  "",
+            term:     4,
+            peers: map[string]heartbeat.PeerInfo{
+                "node2": claiming("node2", 6, 2),
+                "node3": claiming("node3", 7, 3),
+                "node4": claiming("node4", 6, 1),
+            },
+            wantLeader: "node3",
+            wantTerm:   7,
+        },
+        {
+            name:       "takes over from a peer handing leadership to it",
+            selected:   "node1",
+            current:    "node2",
+            term:       4,
+            peers:      map[string]heartbeat.PeerInfo{"node2": handingToLocal},
+            wantLeader: "node1",
+            wantTerm:   5,
+        },
+        {
+            name:       "keeps leading against a weaker claim",
+            selected:   "node1",
+            current:    "node1",
+            term:       6,
+            peers:      map[string]heartbeat.PeerInfo{"node2": claiming("node2", 5, 2)},
+            wantLeader: "node1",
+            wantTerm:   6,
+        },
+        {
+            name:       "steps down to a claim in a higher term",
+            selected:   "node1",
+            current:    "node1",
+            term:       6,
+            peers:      map[string]heartbeat.PeerInfo{"node2": claiming("node2", 7, 2)},
+            wantLeader: "node2",
+            wantTerm:   7,
+        },
+        {
+            name:       "steps down to a better priority in the same term",
+            selected:   "node1",
+            current:    "node1",
+            term:       6,
+            peers:      map[string]heartbeat.PeerInfo{"node2": claiming("node2", 6, 0)},
+            wantLeader: "node2",
+            wantTerm:   6,
+        },
+        {
+            name:     "steps down to the strongest of several conflicting leaders",
+            selected: "node1",
+            current:  "node1",
+            term:     6,
+            peers: map[string]heartbeat.PeerInfo{
+                "node2": claiming("node2", 7, 2),
+                "node3": claiming("node3", 8, 3),
+                "node4": claiming("node4", 8, 2),
+                "node5": claiming("node5", 5, 0),
+            },
+            wantLeader: "node4",
+            wantTerm:   8,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            // Peers come from a map, so repeat to catch order dependence
+            for i := 0; i < 20; i++ {
+                e := newTestElection("node1", 1, tt.term)
+                leader, term := e.resolveTerm(tt.selected, tt.current, tt.term, tt.peers)
+                if leader != tt.wantLeader || term != tt.wantTerm {
+                    t.Fatalf("resolveTerm() = %s, %d, want %s, %d", leader, term, tt.wantLeader, tt.wantTerm)
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,184 @@
+package health
+
+import (
+    "context"
+    "crypto/tls"
+    "crypto/x509"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "os"
+    "os/exec"
+    "regexp"
+    "strings"
+    "time"
+
+    "github.com/2bleere/ha-vip/internal/config"
+)
+
+// maxBodySize bounds how much of an HTTP response body is matched
+const maxBodySize = 64 * 1024
+
+// Check probes one local service. It returns nil when the service is
+// healthy and an error describing the failure otherwise.
+type Check interface {
+    Run(ctx context.Context) error
+}
+
+// newCheck builds the check described by a validated config entry
+func newCheck(cfg config.HealthCheckConfig) (Check, error) {
+    switch cfg.Type {
+    case "tcp":
+        return &tcpCheck{address: cfg.Address}, nil
+    case "http":
+        return newHTTPCheck(cfg)
+    case "exec":
+        return &execCheck{command: cfg.Command}, nil
+    case "file":
+        return &fileCheck{path: cfg.Path}, nil
+    case "etcd":
+        return newEtcdCheck(cfg)
+    }
+    return nil, fmt.Errorf("unknown check type %q", cfg.Type)
+}
+
+// tcpCheck passes when a TCP connection can be established
+type tcpCheck struct {
+    address string
+}
+
+func (c *tcpCheck) Run(ctx context.Context) error {
+    var dialer net.Dialer
+    conn, err := dialer.DialContext(ctx, "tcp", c.address)
+    if err != nil {
+        return err
+    }
+    conn.Close()
+    return nil
+}
+
+// httpCheck passes when a GET returns the expected status and, if set, a
+// body matching the expected pattern
+type httpCheck struct {
+    url          string
+    expectStatus int
+    expectBody   *regexp.Regexp
+    client       *http.Client
+}
+
+func newHTTPCheck(cfg config.HealthCheckConfig) (*httpCheck, error) {
+    tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+    if cfg.CACert != "" {
+        pool, err := loadCAPool(cfg.CACert)
+        if err != nil {
+            return nil, err
+        }
+        tlsConfig.RootCAs = pool
+    }
+
+    check := &httpCheck{
+        url:          cfg.URL,
+        expectStatus: cfg.ExpectStatus,
+        client: &http.Client{
+            Transport: &http.Transport{TLSClientConfig: tlsConfig, DisableKeepAlives: true},
+            // Check the response of the URL itself, not of a redirect
+            CheckRedirect: func(*http.Request, []*http.Request) error {
+                return http.ErrUseLastResponse
+            },
+        },
+    }
+    if cfg.ExpectBody != "" {
+        check.expectBody = regexp.MustCompile(cfg.ExpectBody)
+    }
+    return check, nil
+}
+
+// loadCAPool reads the CA certificates that server certificates are
+// verified against
+func loadCAPool(file string) (*x509.CertPool, error) {
+    caCert, err := os.ReadFile(file)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+    }
+    pool := x509.NewCertPool()
+    if !pool.AppendCertsFromPEM(caCert) {
+        return nil, fmt.Errorf("no certificates found in %s", file)
+    }
+    return pool, nil
+}
+
+func (c *httpCheck) Run(ctx context.Context) error {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+    if err != nil {
+        return err
+    }
+    resp, err := c.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if c.expectStatus != 0 && resp.StatusCode != c.expectStatus {
+        return fmt.Errorf("status %d, expected %d", resp.StatusCode, c.expectStatus)
+    }
+    if c.expectStatus == 0 && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+        return fmt.Errorf("status %d, expected 2xx", resp.StatusCode)
+    }
+    if c.expectBody == nil {
+        return nil
+    }
+
+    body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+    if err != nil {
+        return fmt.Errorf("failed to read body: %w", err)
+    }
+    if !c.expectBody.Match(body) {
+        return fmt.Errorf("body does not match %q", c.expectBody)
+    }
+    return nil
+}
+
+// execCheck passes when the command exits with status 0
+type execCheck struct {
+    command []string
+}
+
+func (c *execCheck) Run(ctx context.Context) error {
+    cmd := exec.CommandContext(ctx, c.command[0], c.command[1:]...)
+    // Do not wait forever for children that keep the output open
+    cmd.WaitDelay = time.Second
+    output, err := cmd.CombinedOutput()
+    if err == nil {
+        return nil
+    }
+    if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+        return fmt.Errorf("timed out")
+    }
+    if out := lastLine(output); out != "" {
+        return fmt.Errorf("%v: %s", err, out)
+    }
+    return err
+}
+
+// fileCheck passes while the file exists
+type fileCheck struct {
+    path string
+}
+
+func (c *fileCheck) Run(ctx context.Context) error {
+    _, err := os.Stat(c.path)
+    return err
+}
+
+// lastLine returns the last non-empty line of a command's output, which
+// usually explains why it failed
+func lastLine(output []byte) string {
+    lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+    line := strings.TrimSpace(lines[len(lines)-1])
+    if len(line) > 200 {
+        line = line[:200] + "..."
+    }
+    return line
+}
@@ -0,0 +1,152 @@
+package health
+
+import (
+    "bytes"
+    "context"
+    "crypto/tls"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+
+    "github.com/2bleere/ha-vip/internal/config"
+)
+
+// Defaults for etcd checks, matching the local member and the health check
+// client certificate kubeadm sets up on control-plane nodes
+const (
+    defaultEtcdURL        = "https://127.0.0.1:2379"
+    defaultEtcdCACert     = "/etc/kubernetes/pki/etcd/ca.crt"
+    defaultEtcdClientCert = "/etc/kubernetes/pki/etcd/healthcheck-client.crt"
+    defaultEtcdClientKey  = "/etc/kubernetes/pki/etcd/healthcheck-client.key"
+    defaultMaxRaftLag     = 1000
+)
+
+// etcdCheck passes while the local etcd member reports itself healthy, is
+// connected to a leader and keeps up with applying the raft log. etcd's
+// /health alone does not catch a member that applies entries too slowly.
+type etcdCheck struct {
+    url        string
+    maxRaftLag uint64
+    client     *http.Client
+}
+
+// etcdStatus is the part of the maintenance status response the check
+// uses. 64-bit integers are encoded as strings, and zero values are left
+// out, so a member without a leader has no leader field.
+type etcdStatus struct {
+    Leader           uint64   `json:"leader,string"`
+    RaftIndex        uint64   `json:"raftIndex,string"`
+    RaftAppliedIndex uint64   `json:"raftAppliedIndex,string"`
+    Errors           []string `json:"errors"`
+}
+
+func newEtcdCheck(cfg config.HealthCheckConfig) (*etcdCheck, error) {
+    endpoint := strings.TrimSuffix(cfg.URL, "/")
+    if endpoint == "" {
+        endpoint = defaultEtcdURL
+    }
+    caCert, clientCert, clientKey := cfg.CACert, cfg.ClientCert, cfg.ClientKey
+    if strings.HasPrefix(endpoint, "https://") && caCert == "" && clientCert == "" && !cfg.InsecureSkipVerify {
+        caCert, clientCert, clientKey = defaultEtcdCACert, defaultEtcdClientCert, defaultEtcdClientKey
+    }
+
+    tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+    if caCert != "" {
+        pool, err := loadCAPool(caCert)
+        if err != nil {
+            return nil, err
+        }
+        tlsConfig.RootCAs = pool
+    }
+    if clientCert != "" {
+        // Loaded for every connection, so renewed certificates are used
+        // without a restart
+        tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+            cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+            if err != nil {
+                return nil, fmt.Errorf("failed to load client certificate: %w", err)
+            }
+            return &cert, nil
+        }
+    }
+
+    maxRaftLag := cfg.MaxRaftLag
+    if maxRaftLag == 0 {
+        maxRaftLag = defaultMaxRaftLag
+    }
+    return &etcdCheck{
+        url:        endpoint,
+        maxRaftLag: uint64(maxRaftLag),
+        client: &http.Client{
+            Transport: &http.Transport{TLSClientConfig: tlsConfig, DisableKeepAlives: true},
+        },
+    }, nil
+}
+
+func (c *etcdCheck) Run(ctx context.Context) error {
+    var health struct {
+        Health string `json:"health"`
+        Reason string `json:"reason"`
+    }
+    if err := c.call(ctx, http.MethodGet, "/health", &health); err != nil {
+        return err
+    }
+    if health.Health != "true" {
+        if health.Reason != "" {
+            return fmt.Errorf("member unhealthy: %s", health.Reason)
+        }
+        return fmt.Errorf("member unhealthy")
+    }
+
+    var status etcdStatus
+    if err := c.call(ctx, http.MethodPost, "/v3/maintenance/status", &status); err != nil {
+        return err
+    }
+    if len(status.Errors) > 0 {
+        return fmt.Errorf("member reports errors: %s", strings.Join(status.Errors, "; "))
+    }
+    if status.Leader == 0 {
+        return fmt.Errorf("member is not connected to a leader")
+    }
+    // Members before etcd 3.4 do not report the applied index
+    if status.RaftAppliedIndex > 0 && status.RaftIndex > status.RaftAppliedIndex+c.maxRaftLag {
+        return fmt.Errorf("member lags %d raft entries behind (max %d)",
+            status.RaftIndex-status.RaftAppliedIndex, c.maxRaftLag)
+    }
+    return nil
+}
+
+// call sends a request to the member and decodes the JSON response. Error
+// responses are reported with their body instead of being decoded, since
+// their JSON would decode into a zero-valued status; etcd answers an
+// unhealthy /health with a 503 whose body carries the reason.
+func (c *etcdCheck) call(ctx context.Context, method, path string, v interface{}) error {
+    var body io.Reader
+    if method == http.MethodPost {
+        body = bytes.NewReader([]byte("{}"))
+    }
+    req, err := http.NewRequestWithContext(ctx, method, c.url+path, body)
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    resp, err := c.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    data, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+    if err != nil {
+        return fmt.Errorf("%s: failed to read body: %w", path, err)
+    }
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        return fmt.Errorf("%s: status %d: %s", path, resp.StatusCode, strings.TrimSpace(string(data)))
+    }
+    if err := json.Unmarshal(data, v); err != nil {
+        return fmt.Errorf("%s: invalid response: %w", path, err)
+    }
+    return nil
+}
@@ -0,0 +1,124 @@
+package health
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/2bleere/ha-vip/internal/config"
+)
+
+// fakeEtcd answers /health and /v3/maintenance/status with fixed responses
+func fakeEtcd(t *testing.T, healthCode int, healthBody string, statusCode int, statusBody string) string {
+    t.Helper()
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.URL.Path {
+        case "/health":
+            w.WriteHeader(healthCode)
+            w.Write([]byte(healthBody))
+        case "/v3/maintenance/status":
+            if r.Method != http.MethodPost {
+                t.Errorf("status requested with %s, want POST", r.Method)
+            }
+            w.WriteHeader(statusCode)
+            w.Write([]byte(statusBody))
+        default:
+            http.NotFound(w, r)
+        }
+    }))
+    t.Cleanup(server.Close)
+    return server.URL
+}
+
+func TestEtcdCheck(t *testing.T) {
+    const healthy = `{"health":"true","reason":""}`
+
+    tests := []struct {
+        name       string
+        healthCode int
+        healthBody string
+        statusCode int
+        statusBody string
+        wantErr    string // Substring of the error, empty for a pass
+    }{
+        {
+            name:       "healthy member",
+            healthCode: 200, healthBody: healthy,
+            statusCode: 200, statusBody: `{"leader":"42","raftIndex":"1100","raftAppliedIndex":"1000"}`,
+        },
+        {
+            name:       "member before etcd 3.4",
+            healthCode: 200, healthBody: healthy,
+            statusCode: 200, statusBody: `{"leader":"42","raftIndex":"5000"}`,
+        },
+        {
+            name:       "unhealthy member",
+            healthCode: 503, healthBody: `{"health":"false","reason":"RAFT NO LEADER"}`,
+            wantErr:    "/health: status 503: " + `{"health":"false","reason":"RAFT NO LEADER"}`,
+        },
+        {
+            name:       "health reports false with 200",
+            healthCode: 200, healthBody: `{"health":"false","reason":"ALARM NOSPACE"}`,
+            wantErr:    "member unhealthy: ALARM NOSPACE",
+        },
+        {
+            name:       "unauthorized health",
+            healthCode: 401, healthBody: `{"error":"unauthorized"}`,
+            wantErr:    "/health: status 401: " + `{"error":"unauthorized"}`,
+        },
+        {
+            name:       "forbidden status",
+            healthCode: 200, healthBody: healthy,
+            statusCode: 403, statusBody: `{"error":"permission denied","code":7}`,
+            wantErr:    "/v3/maintenance/status: status 403: " + `{"error":"permission denied","code":7}`,
+        },
+        {
+            name:       "failing status",
+            healthCode: 200, healthBody: healthy,
+            statusCode: 500, statusBody: `{"error":"etcdserver: request timed out"}`,
+            wantErr:    "/v3/maintenance/status: status 500",
+        },
+        {
+            name:       "invalid status body",
+            healthCode: 200, healthBody: healthy,
+            statusCode: 200, statusBody: `<html>`,
+            wantErr:    "/v3/maintenance/status: invalid response",
+        },
+        {
+            name:       "member errors",
+            healthCode: 200, healthBody: healthy,
+            statusCode: 200, statusBody: `{"leader":"42","errors":["memberID:1 alarm:NOSPACE"]}`,
+            wantErr:    "member reports errors: memberID:1 alarm:NOSPACE",
+        },
+        {
+            name:       "no leader",
+            healthCode: 200, healthBody: healthy,
+            statusCode: 200, statusBody: `{"raftIndex":"10","raftAppliedIndex":"10"}`,
+            wantErr:    "not connected to a leader",
+        },
+        {
+            name:       "raft lag",
+            healthCode: 200, healthBody: healthy,
+            statusCode: 200, statusBody: `{"leader":"42","raftIndex":"3000","raftAppliedIndex":"1000"}`,
+            wantErr:    "member lags 2000 raft entries behind (max 1000)",
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            url := fakeEtcd(t, tt.healthCode, tt.healthBody, tt.statusCode, tt.statusBody)
+            check, err := newEtcdCheck(config.HealthCheckConfig{Name: "etcd", Type: "etcd", URL: url})
+            if err != nil {
+                t.Fatalf("newEtcdCheck() error = %v", err)
+            }
+            err = check.Run(context.Background())
+            switch {
+            case tt.wantErr == "" && err != nil:
+                t.Errorf("Run() error = %v, want nil", err)
+            case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+                t.Errorf("Run() error = %v, want %q", err, tt.wantErr)
+            }
+        })
+    }
+}
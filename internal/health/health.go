@@ -0,0 +1,318 @@
+// Package health runs the local health checks configured under
+// health_checks. A node is healthy only while every unweighted check is;
+// weighted checks adjust the node's priority instead. VIP groups can narrow
+// both to a subset of the checks by name. Each check changes
+// state after rise consecutive passes or fall consecutive failures.
+package health
+
+import (
+    "context"
+    "log"
+    "sync"
+    "time"
+
+    "github.com/2bleere/ha-vip/internal/config"
+    "github.com/2bleere/ha-vip/internal/metrics"
+)
+
+// Defaults for checks that leave the settings unset
+const (
+    defaultInterval = 2 * time.Second
+    defaultTimeout  = 1 * time.Second
+    defaultRise     = 2
+    defaultFall     = 2
+)
+
+// CheckStatus is a snapshot of one check
+type CheckStatus struct {
+    Name       string    `json:"name"`
+    Type       string    `json:"type"`
+    Healthy    bool      `json:"healthy"`
+    Weight     int       `json:"weight,omitempty"`
+    Passes     int       `json:"consecutive_passes"`
+    Failures   int       `json:"consecutive_failures"`
+    LastCheck  time.Time `json:"last_check,omitempty"`
+    LastError  string    `json:"last_error,omitempty"`
+    LastChange time.Time `json:"last_change,omitempty"`
+}
+
+// runner schedules one check and tracks its rise/fall state
+type runner struct {
+    check    Check
+    interval time.Duration
+    timeout  time.Duration
+    rise     int
+    fall     int
+    checked  bool // Set after the first result, which decides the initial state
+    status   CheckStatus
+}
+
+// Manager runs the configured checks and aggregates their results
+type Manager struct {
+    runners     []*runner
+    mu          sync.RWMutex
+    stopCh      chan struct{}
+    subscribers []chan struct{}
+}
+
+// NewManager sets up the configured checks. It returns nil when there are
+// none; a nil Manager always reports the node as healthy.
+func NewManager(checks []config.HealthCheckConfig) (*Manager, error) {
+    if len(checks) == 0 {
+        return nil, nil
+    }
+
+    m := &Manager{stopCh: make(chan struct{})}
+    for _, cfg := range checks {
+        check, err := newCheck(cfg)
+        if err != nil {
+            return nil, err
+        }
+        r := &runner{
+            check:    check,
+            interval: seconds(cfg.Interval, defaultInterval),
+            timeout:  seconds(cfg.Timeout, defaultTimeout),
+            rise:     orDefault(cfg.Rise, defaultRise),
+            fall:     orDefault(cfg.Fall, defaultFall),
+            status:   CheckStatus{Name: cfg.Name, Type: cfg.Type, Weight: cfg.Weight},
+        }
+        m.runners = append(m.runners, r)
+        log.Printf("Health: %s check %s every %v (timeout %v, rise %d, fall %d, weight %d)",
+            cfg.Type, cfg.Name, r.interval, r.timeout, r.rise, r.fall, cfg.Weight)
+    }
+    return m, nil
+}
+
+// Start runs every check until Stop is called
+func (m *Manager) Start() {
+    if m == nil {
+        return
+    }
+
+    var wg sync.WaitGroup
+    for _, r := range m.runners {
+        wg.Add(1)
+        go func(r *runner) {
+            defer wg.Done()
+            m.run(r)
+        }(r)
+    }
+    wg.Wait()
+}
+
+func (m *Manager) Stop() {
+    if m == nil {
+        return
+    }
+    close(m.stopCh)
+}
+
+func (m *Manager) run(r *runner) {
+    ticker := time.NewTicker(r.interval)
+    defer ticker.Stop()
+
+    for {
+        ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+        err := r.check.Run(ctx)
+        cancel()
+        m.record(r, err)
+
+        select {
+        case <-ticker.C:
+        case <-m.stopCh:
+            return
+        }
+    }
+}
+
+// record applies a check result to the rise/fall state of the check
+func (m *Manager) record(r *runner, err error) {
+    if err == nil {
+        metrics.HealthChecks.Inc(r.status.Name, metrics.ResultSuccess)
+    } else {
+        metrics.HealthChecks.Inc(r.status.Name, metrics.ResultFailure)
+    }
+
+    m.mu.Lock()
+    wasHealthy := m.healthyLocked(nil)
+    wasAdjustment := m.adjustmentLocked(nil)
+    now := time.Now()
+    r.status.LastCheck = now
+    r.status.LastError = ""
+    if err == nil {
+        r.status.Passes++
+        r.status.Failures = 0
+    } else {
+        r.status.LastError = err.Error()
+        r.status.Failures++
+        r.status.Passes = 0
+    }
+
+    previous := r.status.Healthy
+    switch {
+    case !r.checked:
+        r.status.Healthy = err == nil
+    case !previous && r.status.Passes >= r.rise:
+        r.status.Healthy = true
+    case previous && r.status.Failures >= r.fall:
+        r.status.Healthy = false
+    }
+    changed := !r.checked || previous != r.status.Healthy
+    if changed {
+        r.status.LastChange = now
+    }
+    r.checked = true
+    status := r.status
+    isHealthy := m.healthyLocked(nil)
+    adjustment := m.adjustmentLocked(nil)
+    m.mu.Unlock()
+
+    metrics.HealthCheckHealthy.SetBool(status.Healthy, status.Name)
+    if !changed {
+        return
+    }
+    if status.Healthy {
+        log.Printf("Health: Check %s is healthy", status.Name)
+    } else {
+        log.Printf("Health: Check %s is unhealthy: %s", status.Name, status.LastError)
+    }
+    if wasHealthy != isHealthy {
+        log.Printf("Health: Node health changed from %v to %v", wasHealthy, isHealthy)
+    }
+    if wasAdjustment != adjustment {
+        log.Printf("Health: Priority adjustment changed from %+d to %+d", wasAdjustment, adjustment)
+    }
+    m.notifySubscribers()
+}
+
+// IsHealthy reports whether every unweighted check is healthy. Checks that
+// have not completed yet count as unhealthy.
+func (m *Manager) IsHealthy() bool {
+    return m.IsHealthyFor(nil)
+}
+
+// IsHealthyFor is IsHealthy limited to the named checks, as selected by a
+// VIP group's health_checks; nil names every check
+func (m *Manager) IsHealthyFor(names []string) bool {
+    if m == nil {
+        return true
+    }
+
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    return m.healthyLocked(names)
+}
+
+func (m *Manager) healthyLocked(names []string) bool {
+    for _, r := range m.runners {
+        if selected(names, r.status.Name) && r.status.Weight == 0 && !r.status.Healthy {
+            return false
+        }
+    }
+    return true
+}
+
+// PriorityAdjustment returns the sum of the weights that currently apply,
+// to be added to the configured priority. A positive weight applies while
+// its check is unhealthy, a negative one while it is healthy.
+func (m *Manager) PriorityAdjustment() int {
+    return m.PriorityAdjustmentFor(nil)
+}
+
+// PriorityAdjustmentFor is PriorityAdjustment limited to the named checks;
+// nil names every check
+func (m *Manager) PriorityAdjustmentFor(names []string) int {
+    if m == nil {
+        return 0
+    }
+
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    return m.adjustmentLocked(names)
+}
+
+func (m *Manager) adjustmentLocked(names []string) int {
+    adjustment := 0
+    for _, r := range m.runners {
+        if !selected(names, r.status.Name) {
+            continue
+        }
+        switch {
+        case r.status.Weight > 0 && !r.status.Healthy:
+            adjustment += r.status.Weight
+        case r.status.Weight < 0 && r.status.Healthy:
+            adjustment += r.status.Weight
+        }
+    }
+    return adjustment
+}
+
+// selected reports whether the check is among names, where nil selects
+// every check
+func selected(names []string, name string) bool {
+    if names == nil {
+        return true
+    }
+    for _, n := range names {
+        if n == name {
+            return true
+        }
+    }
+    return false
+}
+
+// Status returns a snapshot of every check in configuration order
+func (m *Manager) Status() []CheckStatus {
+    if m == nil {
+        return []CheckStatus{}
+    }
+
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    statuses := make([]CheckStatus, 0, len(m.runners))
+    for _, r := range m.runners {
+        statuses = append(statuses, r.status)
+    }
+    return statuses
+}
+
+// Subscribe returns a channel that receives a signal whenever a check
+// changes state. A nil Manager returns a nil channel, which never fires.
+func (m *Manager) Subscribe() <-chan struct{} {
+    if m == nil {
+        return nil
+    }
+
+    ch := make(chan struct{}, 1)
+    m.mu.Lock()
+    m.subscribers = append(m.subscribers, ch)
+    m.mu.Unlock()
+    return ch
+}
+
+func (m *Manager) notifySubscribers() {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+
+    for _, ch := range m.subscribers {
+        select {
+        case ch <- struct{}{}:
+        default:
+            // A signal is already pending
+        }
+    }
+}
+
+func seconds(value int, fallback time.Duration) time.Duration {
+    if value <= 0 {
+        return fallback
+    }
+    return time.Duration(value) * time.Second
+}
+
+func orDefault(value, fallback int) int {
+    if value <= 0 {
+        return fallback
+    }
+    return value
+}
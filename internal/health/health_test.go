@@ -0,0 +1,175 @@
+package health
+
+import (
+    "errors"
+    "testing"
+)
+
+func TestRecordRiseFall(t *testing.T) {
+    fail := errors.New("connection refused")
+
+    tests := []struct {
+        name    string
+        rise    int
+        fall    int
+        results []error
+        want    []bool // Healthy after each result
+    }{
+        {
+            name:    "first pass decides the initial state",
+            rise:    3,
+            fall:    3,
+            results: []error{nil},
+            want:    []bool{true},
+        },
+        {
+            name:    "first failure decides the initial state",
+            rise:    3,
+            fall:    3,
+            results: []error{fail},
+            want:    []bool{false},
+        },
+        {
+            name:    "falls after fall consecutive failures",
+            rise:    2,
+            fall:    2,
+            results: []error{nil, fail, fail, fail},
+            want:    []bool{true, true, false, false},
+        },
+        {
+            name:    "a pass resets the failure count",
+            rise:    2,
+            fall:    2,
+            results: []error{nil, fail, nil, fail, nil},
+            want:    []bool{true, true, true, true, true},
+        },
+        {
+            name:    "rises after rise consecutive passes",
+            rise:    3,
+            fall:    1,
+            results: []error{fail, nil, nil, nil},
+            want:    []bool{false, false, false, true},
+        },
+        {
+            name:    "a failure resets the pass count",
+            rise:    2,
+            fall:    1,
+            results: []error{fail, nil, fail, nil, nil},
+            want:    []bool{false, false, false, false, true},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r := &runner{rise: tt.rise, fall: tt.fall, status: CheckStatus{Name: "test", Type: "tcp"}}
+            m := &Manager{runners: []*runner{r}}
+            for i, err := range tt.results {
+                m.record(r, err)
+                if got := m.IsHealthy(); got != tt.want[i] {
+                    t.Fatalf("after result %d (%v): IsHealthy() = %v, want %v", i, err, got, tt.want[i])
+                }
+            }
+        })
+    }
+}
+
+func TestRecordCounts(t *testing.T) {
+    r := &runner{rise: 2, fall: 2, status: CheckStatus{Name: "test", Type: "tcp"}}
+    m := &Manager{runners: []*runner{r}}
+
+    m.record(r, nil)
+    m.record(r, nil)
+    m.record(r, errors.New("timeout"))
+    status := m.Status()[0]
+    if status.Passes != 0 || status.Failures != 1 || status.LastError != "timeout" {
+        t.Errorf("Status() = %+v, want 0 passes, 1 failure and the last error", status)
+    }
+    m.record(r, nil)
+    status = m.Status()[0]
+    if status.Passes != 1 || status.Failures != 0 || status.LastError != "" {
+        t.Errorf("Status() = %+v, want 1 pass, 0 failures and no error", status)
+    }
+}
+
+func TestNilManager(t *testing.T) {
+    var m *Manager
+    if !m.IsHealthy() || m.PriorityAdjustment() != 0 || len(m.Status()) != 0 {
+        t.Errorf("nil Manager should be healthy with no adjustment and no checks")
+    }
+}
+
+// stateManager returns a Manager whose checks are already in the given
+// states, without running them
+func stateManager(checks ...CheckStatus) *Manager {
+    m := &Manager{}
+    for _, status := range checks {
+        m.runners = append(m.runners, &runner{checked: true, status: status})
+    }
+    return m
+}
+
+func TestPriorityAdjustment(t *testing.T) {
+    tests := []struct {
+        name        string
+        checks      []CheckStatus
+        wantAdjust  int
+        wantHealthy bool
+    }{
+        {"no weights", []CheckStatus{{Name: "a", Healthy: true}}, 0, true},
+        {"positive weight applies while failing", []CheckStatus{{Name: "a", Weight: 5}}, 5, true},
+        {"positive weight ignored while passing", []CheckStatus{{Name: "a", Weight: 5, Healthy: true}}, 0, true},
+        {"negative weight applies while passing", []CheckStatus{{Name: "a", Weight: -3, Healthy: true}}, -3, true},
+        {"negative weight ignored while failing", []CheckStatus{{Name: "a", Weight: -3}}, 0, true},
+        {
+            "weights add up",
+            []CheckStatus{{Name: "a", Weight: 5}, {Name: "b", Weight: 2}, {Name: "c", Weight: -1, Healthy: true}},
+            6, true,
+        },
+        {
+            "unweighted failure makes the node unhealthy",
+            []CheckStatus{{Name: "a", Weight: 5}, {Name: "b"}},
+            5, false,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            m := stateManager(tt.checks...)
+            if got := m.PriorityAdjustment(); got != tt.wantAdjust {
+                t.Errorf("PriorityAdjustment() = %+d, want %+d", got, tt.wantAdjust)
+            }
+            if got := m.IsHealthy(); got != tt.wantHealthy {
+                t.Errorf("IsHealthy() = %v, want %v", got, tt.wantHealthy)
+            }
+        })
+    }
+}
+
+func TestGroupSelection(t *testing.T) {
+    m := stateManager(
+        CheckStatus{Name: "apiserver", Healthy: true},
+        CheckStatus{Name: "ingress"},
+        CheckStatus{Name: "backends", Weight: 5},
+    )
+
+    tests := []struct {
+        name        string
+        names       []string
+        wantHealthy bool
+        wantAdjust  int
+    }{
+        {"every check", nil, false, 5},
+        {"no checks", []string{}, true, 0},
+        {"healthy check only", []string{"apiserver"}, true, 0},
+        {"failing check", []string{"apiserver", "ingress"}, false, 0},
+        {"weighted check only", []string{"backends"}, true, 5},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := m.IsHealthyFor(tt.names); got != tt.wantHealthy {
+                t.Errorf("IsHealthyFor(%q) = %v, want %v", tt.names, got, tt.wantHealthy)
+            }
+            if got := m.PriorityAdjustmentFor(tt.names); got != tt.wantAdjust {
+                t.Errorf("PriorityAdjustmentFor(%q) = %+d, want %+d", tt.names, got, tt.wantAdjust)
+            }
+        })
+    }
+}
@@ -0,0 +1,227 @@
+package heartbeat
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "log"
+    "os"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/2bleere/ha-vip/internal/config"
+)
+
+// Reasons a heartbeat can be rejected by the authenticator
+const (
+    RejectUnsigned     = "unsigned"
+    RejectBadSignature = "bad_signature"
+    RejectReplayed     = "replayed"
+    RejectStale        = "stale"
+    RejectIdentity     = "identity"
+)
+
+// maxRejectSources bounds how many source addresses rejections are tracked
+// for, since unauthenticated packets can come from any spoofed address.
+// When it is reached, the source rejected longest ago is forgotten.
+const maxRejectSources = 256
+
+// rejectError is returned for a dropped heartbeat and carries the reason
+type rejectError string
+
+func (e rejectError) Error() string { return string(e) }
+
+// SignedMessage is the wire envelope used when a pre-shared key is
+// configured. The signature covers the raw payload bytes so that peers
+// running different versions still agree on what was signed.
+type SignedMessage struct {
+    Payload   json.RawMessage `json:"payload"`
+    Signature string          `json:"sig"`
+}
+
+// RejectStats counts heartbeats dropped from a single source address.
+type RejectStats struct {
+    Unsigned     uint64    `json:"unsigned"`
+    BadSignature uint64    `json:"bad_signature"`
+    Replayed     uint64    `json:"replayed"`
+    Stale        uint64    `json:"stale"`
+    Identity     uint64    `json:"identity"`
+    LastReason   string    `json:"last_reason"`
+    LastRejected time.Time `json:"last_rejected"`
+}
+
+type authenticator struct {
+    key     []byte
+    maxSkew time.Duration
+    mu      sync.Mutex
+    seq     uint64
+    lastSeq map[string]uint64
+    rejects map[string]*rejectSource
+}
+
+// rejectSource tracks the heartbeats rejected from one source address
+type rejectSource struct {
+    stats   RejectStats
+    lastLog time.Time
+}
+
+func newAuthenticator(cfg *config.Config) (*authenticator, error) {
+    key := cfg.AuthKey
+    if cfg.AuthKeyFile != "" {
+        data, err := os.ReadFile(cfg.AuthKeyFile)
+        if err != nil {
+            return nil, fmt.Errorf("failed to read auth key file %s: %w", cfg.AuthKeyFile, err)
+        }
+        key = strings.TrimSpace(string(data))
+    }
+    if key == "" {
+        return nil, nil
+    }
+
+    maxSkew := time.Duration(cfg.MaxClockSkew) * time.Second
+    if maxSkew <= 0 {
+        maxSkew = 10 * time.Second
+    }
+
+    return &authenticator{
+        key:     []byte(key),
+        maxSkew: maxSkew,
+        // Seed the sequence from the clock so it keeps increasing across
+        // restarts and peers do not mistake a fresh process for a replay
+        seq:     uint64(time.Now().UnixNano()),
+        lastSeq: make(map[string]uint64),
+        rejects: make(map[string]*rejectSource),
+    }, nil
+}
+
+// seal stamps the message with the next sequence number and the current
+// time, then wraps it in a signed envelope.
+func (a *authenticator) seal(msg HeartbeatMessage) ([]byte, error) {
+    a.mu.Lock()
+    a.seq++
+    msg.Seq = a.seq
+    a.mu.Unlock()
+    msg.Timestamp = time.Now().UnixMilli()
+
+    payload, err := json.Marshal(msg)
+    if err != nil {
+        return nil, err
+    }
+
+    return json.Marshal(SignedMessage{
+        Payload:   payload,
+        Signature: a.sign(payload),
+    })
+}
+
+func (a *authenticator) sign(payload []byte) string {
+    mac := hmac.New(sha256.New, a.key)
+    mac.Write(payload)
+    return hex.EncodeToString(mac.Sum(nil))
+}
+
+// open verifies a signed envelope received from source and returns the
+// heartbeat it carries. Rejected packets are counted against source. The
+// node ID must be one identity allows, checked before its sequence number
+// is recorded so a foreign node cannot advance it.
+func (a *authenticator) open(data []byte, source string, identity certIdentity) (HeartbeatMessage, error) {
+    var msg HeartbeatMessage
+
+    var envelope SignedMessage
+    if err := json.Unmarshal(data, &envelope); err != nil || len(envelope.Payload) == 0 || envelope.Signature == "" {
+        return msg, a.reject(source, RejectUnsigned)
+    }
+
+    expected := a.sign(envelope.Payload)
+    if !hmac.Equal([]byte(expected), []byte(envelope.Signature)) {
+        return msg, a.reject(source, RejectBadSignature)
+    }
+
+    if err := json.Unmarshal(envelope.Payload, &msg); err != nil {
+        return msg, a.reject(source, RejectBadSignature)
+    }
+
+    skew := time.Since(time.UnixMilli(msg.Timestamp))
+    if skew > a.maxSkew || skew < -a.maxSkew {
+        return msg, a.reject(source, RejectStale)
+    }
+
+    if !identity.allows(msg.NodeID) {
+        return msg, a.reject(source, RejectIdentity)
+    }
+
+    a.mu.Lock()
+    last := a.lastSeq[msg.NodeID]
+    if msg.Seq <= last {
+        a.mu.Unlock()
+        return msg, a.reject(source, RejectReplayed)
+    }
+    a.lastSeq[msg.NodeID] = msg.Seq
+    a.mu.Unlock()
+
+    return msg, nil
+}
+
+func (a *authenticator) reject(source, reason string) error {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+
+    tracked, ok := a.rejects[source]
+    if !ok {
+        if len(a.rejects) >= maxRejectSources {
+            a.forgetOldestSource()
+        }
+        tracked = &rejectSource{}
+        a.rejects[source] = tracked
+    }
+    stats := &tracked.stats
+    switch reason {
+    case RejectUnsigned:
+        stats.Unsigned++
+    case RejectBadSignature:
+        stats.BadSignature++
+    case RejectReplayed:
+        stats.Replayed++
+    case RejectStale:
+        stats.Stale++
+    case RejectIdentity:
+        stats.Identity++
+    }
+    stats.LastReason = reason
+    stats.LastRejected = time.Now()
+
+    // Avoid flooding the log when a source keeps sending bad packets
+    if time.Since(tracked.lastLog) >= 30*time.Second {
+        tracked.lastLog = time.Now()
+        log.Printf("Heartbeat: Rejected %s heartbeat from %s (totals: unsigned=%d, bad_signature=%d, replayed=%d, stale=%d, identity=%d)",
+            reason, source, stats.Unsigned, stats.BadSignature, stats.Replayed, stats.Stale, stats.Identity)
+    }
+
+    return rejectError(reason)
+}
+
+// forgetOldestSource drops the source rejected longest ago. It is called
+// with a.mu held.
+func (a *authenticator) forgetOldestSource() {
+    oldest := ""
+    for source, tracked := range a.rejects {
+        if oldest == "" || tracked.stats.LastRejected.Before(a.rejects[oldest].stats.LastRejected) {
+            oldest = source
+        }
+    }
+    delete(a.rejects, oldest)
+}
+
+func (a *authenticator) stats() map[string]RejectStats {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+
+    result := make(map[string]RejectStats, len(a.rejects))
+    for source, tracked := range a.rejects {
+        result[source] = tracked.stats
+    }
+    return result
+}
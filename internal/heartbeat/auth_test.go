@@ -0,0 +1,173 @@
+package heartbeat
+
+import (
+    "encoding/json"
+    "fmt"
+    "testing"
+    "time"
+
+    "github.com/2bleere/ha-vip/internal/config"
+)
+
+func newTestAuthenticator(t *testing.T, key string) *authenticator {
+    t.Helper()
+    a, err := newAuthenticator(&config.Config{AuthKey: key, MaxClockSkew: 10})
+    if err != nil {
+        t.Fatalf("newAuthenticator() error = %v", err)
+    }
+    return a
+}
+
+// resign wraps a modified payload in an envelope signed with a's key
+func resign(t *testing.T, a *authenticator, msg HeartbeatMessage) []byte {
+    t.Helper()
+    payload, err := json.Marshal(msg)
+    if err != nil {
+        t.Fatal(err)
+    }
+    data, err := json.Marshal(SignedMessage{Payload: payload, Signature: a.sign(payload)})
+    if err != nil {
+        t.Fatal(err)
+    }
+    return data
+}
+
+func TestNewAuthenticatorWithoutKey(t *testing.T) {
+    a, err := newAuthenticator(&config.Config{})
+    if err != nil || a != nil {
+        t.Fatalf("newAuthenticator() = %v, %v, want nil, nil", a, err)
+    }
+}
+
+func TestSealOpen(t *testing.T) {
+    sender := newTestAuthenticator(t, "secret")
+    receiver := newTestAuthenticator(t, "secret")
+
+    sealed, err := sender.seal(HeartbeatMessage{NodeID: "node2", Priority: 2, Healthy: true})
+    if err != nil {
+        t.Fatalf("seal() error = %v", err)
+    }
+    msg, err := receiver.open(sealed, "10.0.0.2", nil)
+    if err != nil {
+        t.Fatalf("open() error = %v", err)
+    }
+    if msg.NodeID != "node2" || msg.Priority != 2 || !msg.Healthy || msg.Seq == 0 || msg.Timestamp == 0 {
+        t.Errorf("open() = %+v, want the sealed heartbeat with a sequence and timestamp", msg)
+    }
+}
+
+func TestOpenRejects(t *testing.T) {
+    sender := newTestAuthenticator(t, "secret")
+    sealed, err := sender.seal(HeartbeatMessage{NodeID: "node2"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    var envelope SignedMessage
+    if err := json.Unmarshal(sealed, &envelope); err != nil {
+        t.Fatal(err)
+    }
+    var sent HeartbeatMessage
+    if err := json.Unmarshal(envelope.Payload, &sent); err != nil {
+        t.Fatal(err)
+    }
+
+    tampered := envelope
+    tampered.Payload = json.RawMessage(`{"node_id":"node3","priority":0}`)
+    tamperedData, _ := json.Marshal(tampered)
+
+    stale := sent
+    stale.Seq++
+    stale.Timestamp = time.Now().Add(-time.Minute).UnixMilli()
+    future := sent
+    future.Seq++
+    future.Timestamp = time.Now().Add(time.Minute).UnixMilli()
+    older := sent
+    older.Seq--
+
+    tests := []struct {
+        name     string
+        key      string
+        data     []byte
+        identity certIdentity
+        want     string
+    }{
+        {"plain JSON", "secret", []byte(`{"node_id":"node2","priority":1}`), nil, RejectUnsigned},
+        {"not JSON", "secret", []byte("node2"), nil, RejectUnsigned},
+        {"wrong key", "other", sealed, nil, RejectBadSignature},
+        {"tampered payload", "secret", tamperedData, nil, RejectBadSignature},
+        {"stale timestamp", "secret", resign(t, sender, stale), nil, RejectStale},
+        {"future timestamp", "secret", resign(t, sender, future), nil, RejectStale},
+        {"older sequence", "secret", resign(t, sender, older), nil, RejectReplayed},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            receiver := newTestAuthenticator(t, tt.key)
+            if tt.want == RejectReplayed {
+                // The receiver has already seen the original heartbeat
+                if _, err := receiver.open(sealed, "10.0.0.2", nil); err != nil {
+                    t.Fatalf("open() of the original error = %v", err)
+                }
+            }
+            _, err := receiver.open(tt.data, "10.0.0.2", tt.identity)
+            if err != rejectError(tt.want) {
+                t.Fatalf("open() error = %v, want %s", err, tt.want)
+            }
+            stats := receiver.stats()["10.0.0.2"]
+            if stats.LastReason != tt.want {
+                t.Errorf("LastReason = %q, want %q", stats.LastReason, tt.want)
+            }
+        })
+    }
+}
+
+func TestOpenRejectsReplay(t *testing.T) {
+    sender := newTestAuthenticator(t, "secret")
+    receiver := newTestAuthenticator(t, "secret")
+
+    first, _ := sender.seal(HeartbeatMessage{NodeID: "node2"})
+    second, _ := sender.seal(HeartbeatMessage{NodeID: "node2"})
+    if _, err := receiver.open(first, "10.0.0.2", nil); err != nil {
+        t.Fatalf("open(first) error = %v", err)
+    }
+    if _, err := receiver.open(first, "10.0.0.2", nil); err != rejectError(RejectReplayed) {
+        t.Fatalf("open(first) again error = %v, want %s", err, RejectReplayed)
+    }
+    if _, err := receiver.open(second, "10.0.0.2", nil); err != nil {
+        t.Fatalf("open(second) error = %v", err)
+    }
+    if _, err := receiver.open(first, "10.0.0.2", nil); err != rejectError(RejectReplayed) {
+        t.Fatalf("open(first) after second error = %v, want %s", err, RejectReplayed)
+    }
+    if got := receiver.stats()["10.0.0.2"].Replayed; got != 2 {
+        t.Errorf("Replayed = %d, want 2", got)
+    }
+}
+
+func TestRejectSourcesAreBounded(t *testing.T) {
+    a := newTestAuthenticator(t, "secret")
+    for i := 0; i < maxRejectSources+50; i++ {
+        a.open([]byte("garbage"), fmt.Sprintf("10.0.%d.%d", i/256, i%256), nil)
+    }
+
+    stats := a.stats()
+    if len(stats) != maxRejectSources {
+        t.Fatalf("%d sources tracked, want %d", len(stats), maxRejectSources)
+    }
+    // The sources rejected first are forgotten, the latest one is kept
+    if _, ok := stats["10.0.0.0"]; ok {
+        t.Error("oldest source still tracked")
+    }
+    last := maxRejectSources + 49
+    if s, ok := stats[fmt.Sprintf("10.0.%d.%d", last/256, last%256)]; !ok || s.Unsigned != 1 {
+        t.Errorf("latest source = %+v, %v, want one unsigned rejection", s, ok)
+    }
+
+    // A tracked source keeps counting without evicting anything
+    for i := 0; i < 3; i++ {
+        a.open([]byte("garbage"), "10.0.1.0", nil)
+    }
+    stats = a.stats()
+    if len(stats) != maxRejectSources || stats["10.0.1.0"].Unsigned != 4 {
+        t.Errorf("%d sources, 10.0.1.0 = %+v, want %d sources and 4 rejections", len(stats), stats["10.0.1.0"], maxRejectSources)
+    }
+}
@@ -1,6 +1,7 @@
 package heartbeat
 
 import (
+    "crypto/tls"
     "encoding/json"
     "log"
     "net"
@@ -8,50 +9,147 @@ import (
     "time"
 
     "github.com/2bleere/ha-vip/internal/config"
+    "github.com/2bleere/ha-vip/internal/health"
     "github.com/2bleere/ha-vip/internal/k8s"
+    "github.com/2bleere/ha-vip/internal/metrics"
 )
 
-type HeartbeatMessage struct {
-    NodeID   string `json:"node_id"`
+// GroupState is a node's standing in one VIP group as advertised in
+// heartbeats
+type GroupState struct {
     Priority int    `json:"priority"`
     Healthy  bool   `json:"healthy"`
-    K8sMode  bool   `json:"k8s_mode"`
+    Term     uint64 `json:"term,omitempty"`      // Sender's current election term
+    Leader   string `json:"leader,omitempty"`    // Leader the sender recognises in that term
+    Handover string `json:"handover,omitempty"`  // Node the sender is handing leadership to
+    HoldsVIP bool   `json:"holds_vip,omitempty"` // Sender has the group's VIPs assigned
+}
+
+// leadershipClaim is the local election state advertised for a group
+type leadershipClaim struct {
+    Leader   string
+    Term     uint64
+    Handover string
+}
+
+type HeartbeatMessage struct {
+    NodeID      string                `json:"node_id"`
+    Priority    int                   `json:"priority"`
+    Healthy     bool                  `json:"healthy"`
+    K8sMode     bool                  `json:"k8s_mode"`
+    Maintenance bool                  `json:"maintenance,omitempty"` // Sender is ineligible for leadership
+    Leaving     bool                  `json:"leaving,omitempty"`     // Sender is shutting down
+    Groups      map[string]GroupState `json:"groups,omitempty"`
+    Seq         uint64                `json:"seq,omitempty"`
+    Timestamp   int64                 `json:"ts,omitempty"` // Unix milliseconds
 }
 
 type PeerInfo struct {
-    LastSeen time.Time
-    Priority int
-    Healthy  bool
-    K8sMode  bool
+    Address     string // Source IP of the latest heartbeat
+    LastSeen    time.Time
+    Priority    int
+    Healthy     bool
+    K8sMode     bool
+    Groups      map[string]GroupState
+    Maintenance bool
+}
+
+// Group returns the peer's state in the named VIP group and whether the
+// peer takes part in it. Peers that predate VIP groups only take part in
+// the default group, with their node-wide priority and health.
+func (p PeerInfo) Group(name string) (GroupState, bool) {
+    if p.Groups == nil {
+        if name == config.DefaultGroup {
+            return GroupState{Priority: p.Priority, Healthy: p.Healthy}, true
+        }
+        return GroupState{}, false
+    }
+    state, ok := p.Groups[name]
+    return state, ok
 }
 
 type Heartbeat struct {
     cfg            *config.Config
     k8sChecker     *k8s.K8sHealthChecker
+    healthChecks   *health.Manager
     peers          map[string]PeerInfo
     mu             sync.Mutex
     stopCh         chan struct{}
     conn           *net.UDPConn
     lastSentHealth map[string]bool
+    tlsConfig      *tls.Config
+    listener       net.Listener
+    tlsPeers       map[string]*tlsPeer
+    auth           *authenticator
+    leadership     map[string]leadershipClaim
+    subscribers    []chan struct{}
+    lastSeen       map[string]time.Time // For peer metrics, kept for peerMetricsRetention
+    vipHeld        map[string]bool
+    sendNow        chan struct{}
+    maintenance    bool
+    leaving        bool
 }
 
-func NewHeartbeat(cfg *config.Config, k8sChecker *k8s.K8sHealthChecker) *Heartbeat {
-    return &Heartbeat{
+func NewHeartbeat(cfg *config.Config, k8sChecker *k8s.K8sHealthChecker, healthChecks *health.Manager) *Heartbeat {
+    h := &Heartbeat{
         cfg:            cfg,
         k8sChecker:     k8sChecker,
+        healthChecks:   healthChecks,
         peers:          make(map[string]PeerInfo),
         stopCh:         make(chan struct{}),
         lastSentHealth: make(map[string]bool),
+        tlsPeers:       make(map[string]*tlsPeer),
+        leadership:     make(map[string]leadershipClaim),
+        lastSeen:       make(map[string]time.Time),
+        vipHeld:        make(map[string]bool),
+        sendNow:        make(chan struct{}, 1),
+    }
+
+    switch cfg.HeartbeatTransport {
+    case "", TransportUDP:
+        log.Printf("Heartbeat: Using plain UDP transport on port %d", cfg.Port)
+    case TransportTLS:
+        tlsConfig, err := newTLSConfig(cfg)
+        if err != nil {
+            // Never fall back to plain UDP when TLS was requested
+            log.Fatalf("Failed to set up TLS heartbeat transport: %v", err)
+        }
+        h.tlsConfig = tlsConfig
+        log.Printf("Heartbeat: Using mutually authenticated TLS transport on port %d", cfg.Port)
+    default:
+        log.Fatalf("Unknown heartbeat transport %q (expected %q or %q)", cfg.HeartbeatTransport, TransportUDP, TransportTLS)
+    }
+
+    auth, err := newAuthenticator(cfg)
+    if err != nil {
+        log.Fatalf("Failed to set up heartbeat signing: %v", err)
+    }
+    if auth != nil {
+        h.auth = auth
+        log.Printf("Heartbeat: Signing heartbeats with pre-shared key, unsigned heartbeats will be rejected")
     }
+
+    metrics.NewGaugeFunc("peer_last_seen_seconds", "Seconds since the last heartbeat from the peer.",
+        []string{"peer"}, h.peerAgeMetrics)
+    metrics.NewGaugeFunc("peer_healthy", "Whether the peer is active and reports itself healthy (1) or not (0).",
+        []string{"peer"}, h.peerHealthMetrics)
+
+    return h
 }
 
 func (h *Heartbeat) Start() {
-    go h.listen()
+    if h.tlsConfig != nil {
+        go h.listenTLS()
+    } else {
+        go h.listen()
+    }
     ticker := time.NewTicker(time.Duration(h.cfg.HeartbeatInterval) * time.Second)
     for {
         select {
         case <-ticker.C:
             h.send()
+        case <-h.sendNow:
+            h.send()
         case <-h.stopCh:
             return
         }
@@ -60,17 +158,46 @@ func (h *Heartbeat) Start() {
 
 func (h *Heartbeat) send() {
     // Create heartbeat message with current health status
-    healthy := true
+    k8sHealthy := true
     if h.cfg.K8s.Enabled && h.k8sChecker != nil {
-        healthy = h.k8sChecker.IsHealthy()
+        k8sHealthy = h.k8sChecker.IsHealthy()
+    }
+    checksHealthy := h.healthChecks.IsHealthy()
+    healthy := k8sHealthy && checksHealthy
+    // Weighted checks advertise an effective priority
+    adjustment := h.healthChecks.PriorityAdjustment()
+    
+    groups := make(map[string]GroupState)
+    h.mu.Lock()
+    for _, group := range h.cfg.Groups() {
+        // Each group only counts the health checks it selects
+        groupHealthy := h.healthChecks.IsHealthyFor(group.HealthChecks)
+        if group.UsesK8sHealth() {
+            groupHealthy = groupHealthy && k8sHealthy
+        }
+        claim := h.leadership[group.Name]
+        groups[group.Name] = GroupState{
+            Priority: group.Priority + h.healthChecks.PriorityAdjustmentFor(group.HealthChecks),
+            Healthy:  groupHealthy,
+            Term:     claim.Term,
+            Leader:   claim.Leader,
+            Handover: claim.Handover,
+            HoldsVIP: h.vipHeld[group.Name],
+        }
     }
+    h.mu.Unlock()
     
     msg := HeartbeatMessage{
         NodeID:   h.cfg.NodeID,
-        Priority: h.cfg.Priority,
+        Priority: h.cfg.Priority + adjustment,
         Healthy:  healthy,
         K8sMode:  h.cfg.K8s.Enabled,
+        Groups:   groups,
     }
+    h.mu.Lock()
+    msg.Maintenance = h.maintenance
+    msg.Leaving = h.leaving
+    h.mu.Unlock()
     
     // Only log heartbeat when health status changes
     h.mu.Lock()
@@ -82,23 +209,43 @@ func (h *Heartbeat) send() {
     }
     h.mu.Unlock()
     
-    msgBytes, err := json.Marshal(msg)
+    var msgBytes []byte
+    var err error
+    if h.auth != nil {
+        msgBytes, err = h.auth.seal(msg)
+    } else {
+        msgBytes, err = json.Marshal(msg)
+    }
     if err != nil {
         log.Printf("Failed to marshal heartbeat message: %v", err)
         return
     }
     
+    if h.tlsConfig != nil {
+        h.sendTLS(msgBytes)
+        return
+    }
+    
     for _, peer := range h.cfg.Peers {
         conn, err := net.Dial("udp", peer)
-        if err == nil {
-            conn.Write(msgBytes)
-            conn.Close()
+        if err != nil {
+            metrics.HeartbeatsSent.Inc(metrics.ResultFailure)
+            metrics.HeartbeatErrors.Inc("send")
+            continue
         }
+        if _, err := conn.Write(msgBytes); err != nil {
+            metrics.HeartbeatsSent.Inc(metrics.ResultFailure)
+            metrics.HeartbeatErrors.Inc("send")
+        } else {
+            metrics.HeartbeatsSent.Inc(metrics.ResultSuccess)
+        }
+        conn.Close()
     }
 }
 
 func (h *Heartbeat) listen() {
-    addr := net.UDPAddr{Port: h.cfg.Port, IP: net.IPv4zero}
+    // Unspecified IP binds a dual-stack socket so IPv4 and IPv6 peers work
+    addr := net.UDPAddr{Port: h.cfg.Port}
     conn, err := net.ListenUDP("udp", &addr)
     if err != nil {
         log.Printf("Failed to start UDP listener: %v", err)
@@ -106,7 +253,7 @@ func (h *Heartbeat) listen() {
     }
     h.conn = conn
     
-    buf := make([]byte, 1024)
+    buf := make([]byte, 65535)
     for {
         select {
         case <-h.stopCh:
@@ -114,58 +261,271 @@ func (h *Heartbeat) listen() {
         default:
             // Reduced read timeout for faster response
             conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
-            n, _, err := conn.ReadFromUDP(buf)
+            n, src, err := conn.ReadFromUDP(buf)
             if err != nil {
                 if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
                     continue
                 }
                 log.Printf("UDP read error: %v", err)
+                metrics.HeartbeatErrors.Inc("receive")
                 continue
             }
             
-            // Try to parse as JSON heartbeat message
-            var msg HeartbeatMessage
-            if err := json.Unmarshal(buf[:n], &msg); err != nil {
-                // Fallback to old format (just node ID)
-                peerID := string(buf[:n])
-                h.mu.Lock()
-                h.peers[peerID] = PeerInfo{
-                    LastSeen: time.Now(),
-                    Priority: 100, // Default low priority
-                    Healthy:  !h.cfg.K8s.Enabled, // Healthy if K8s is disabled
-                    K8sMode:  false,
-                }
-                h.mu.Unlock()
-                continue
-            }
-            
-            h.mu.Lock()
-            // Enhanced logging for received heartbeats
-            oldPeer, existed := h.peers[msg.NodeID]
-            h.peers[msg.NodeID] = PeerInfo{
-                LastSeen: time.Now(),
-                Priority: msg.Priority,
-                Healthy:  msg.Healthy,
-                K8sMode:  msg.K8sMode,
-            }
-            
-            if !existed {
-                log.Printf("Heartbeat: New peer discovered - %s (Priority: %d, Healthy: %v, K8sMode: %v)", 
-                    msg.NodeID, msg.Priority, msg.Healthy, msg.K8sMode)
-            } else if oldPeer.Healthy != msg.Healthy {
-                log.Printf("Heartbeat: Peer %s health changed from %v to %v (Priority: %d, K8sMode: %v)", 
-                    msg.NodeID, oldPeer.Healthy, msg.Healthy, msg.Priority, msg.K8sMode)
-            }
-            h.mu.Unlock()
+            h.handleMessage(buf[:n], src.IP.String(), nil)
         }
     }
 }
 
+// handleMessage records a heartbeat received from a peer at source,
+// regardless of the transport it arrived on. Heartbeats whose node ID the
+// sender's certificate does not vouch for are rejected with RejectIdentity;
+// a nil identity allows any node ID.
+func (h *Heartbeat) handleMessage(data []byte, source string, identity certIdentity) error {
+    var msg HeartbeatMessage
+    if h.auth != nil {
+        // Signed mode: no fallback to unsigned formats
+        var err error
+        if msg, err = h.auth.open(data, source, identity); err != nil {
+            metrics.HeartbeatErrors.Inc("rejected")
+            return err
+        }
+    } else if err := json.Unmarshal(data, &msg); err != nil {
+        if len(data) > 0 && data[0] == '{' {
+            // Looks like a heartbeat but does not parse
+            metrics.HeartbeatErrors.Inc("parse")
+            return nil
+        }
+        // Fallback to old format (just node ID)
+        peerID := string(data)
+        if !identity.allows(peerID) {
+            metrics.HeartbeatErrors.Inc("rejected")
+            return rejectError(RejectIdentity)
+        }
+        h.mu.Lock()
+        h.peers[peerID] = PeerInfo{
+            LastSeen: time.Now(),
+            Priority: 100, // Default low priority
+            Healthy:  !h.cfg.K8s.Enabled, // Healthy if K8s is disabled
+            K8sMode:  false,
+        }
+        h.mu.Unlock()
+        return nil
+    } else if !identity.allows(msg.NodeID) {
+        metrics.HeartbeatErrors.Inc("rejected")
+        return rejectError(RejectIdentity)
+    }
+    
+    metrics.HeartbeatsReceived.Inc()
+    
+    if msg.Leaving {
+        // Drop the peer now instead of waiting for it to time out
+        h.mu.Lock()
+        _, existed := h.peers[msg.NodeID]
+        delete(h.peers, msg.NodeID)
+        h.mu.Unlock()
+        
+        if existed {
+            log.Printf("Heartbeat: Peer %s is shutting down, removed it from the active peers", msg.NodeID)
+            h.notifySubscribers()
+        }
+        return nil
+    }
+    
+    h.mu.Lock()
+    // Enhanced logging for received heartbeats
+    h.lastSeen[msg.NodeID] = time.Now()
+    oldPeer, existed := h.peers[msg.NodeID]
+    h.peers[msg.NodeID] = PeerInfo{
+        Address:     source,
+        LastSeen:    time.Now(),
+        Priority:    msg.Priority,
+        Healthy:     msg.Healthy,
+        K8sMode:     msg.K8sMode,
+        Groups:      msg.Groups,
+        Maintenance: msg.Maintenance,
+    }
+    
+    if !existed {
+        log.Printf("Heartbeat: New peer discovered - %s (Priority: %d, Healthy: %v, K8sMode: %v)", 
+            msg.NodeID, msg.Priority, msg.Healthy, msg.K8sMode)
+    } else if oldPeer.Healthy != msg.Healthy {
+        log.Printf("Heartbeat: Peer %s health changed from %v to %v (Priority: %d, K8sMode: %v)", 
+            msg.NodeID, oldPeer.Healthy, msg.Healthy, msg.Priority, msg.K8sMode)
+    }
+    if existed && oldPeer.Maintenance != msg.Maintenance {
+        log.Printf("Heartbeat: Peer %s maintenance mode changed from %v to %v", msg.NodeID, oldPeer.Maintenance, msg.Maintenance)
+    }
+    
+    // Wake elections straight away when a peer's leadership claim or
+    // eligibility changes so that they are acted on without waiting for a tick
+    notify := !existed || leadershipChanged(oldPeer.Groups, msg.Groups) || oldPeer.Maintenance != msg.Maintenance
+    h.mu.Unlock()
+    
+    if notify {
+        h.notifySubscribers()
+    }
+    return nil
+}
+
+func leadershipChanged(prev, next map[string]GroupState) bool {
+    if len(prev) != len(next) {
+        return true
+    }
+    for name, state := range next {
+        previous, ok := prev[name]
+        if !ok || previous.Leader != state.Leader || previous.Term != state.Term ||
+            previous.Handover != state.Handover || previous.HoldsVIP != state.HoldsVIP {
+            return true
+        }
+    }
+    return false
+}
+
+// Subscribe returns a channel that receives a signal whenever a new peer
+// appears or a peer's leadership claim changes.
+func (h *Heartbeat) Subscribe() <-chan struct{} {
+    ch := make(chan struct{}, 1)
+    h.mu.Lock()
+    h.subscribers = append(h.subscribers, ch)
+    h.mu.Unlock()
+    return ch
+}
+
+func (h *Heartbeat) notifySubscribers() {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    
+    for _, ch := range h.subscribers {
+        select {
+        case ch <- struct{}{}:
+        default:
+            // A signal is already pending
+        }
+    }
+}
+
+// SetLeadership sets the leader, term and handover target advertised for a
+// VIP group in subsequent heartbeats. A change to the handover target is
+// sent to peers straight away.
+func (h *Heartbeat) SetLeadership(group, leader string, term uint64, handover string) {
+    h.mu.Lock()
+    previous := h.leadership[group]
+    h.leadership[group] = leadershipClaim{Leader: leader, Term: term, Handover: handover}
+    h.mu.Unlock()
+    
+    if previous.Handover != handover {
+        h.SendNow()
+    }
+}
+
+// SetVIPHeld sets whether this node advertises holding the VIPs of a group.
+// Changes are sent to peers straight away, since a handover waits for them.
+func (h *Heartbeat) SetVIPHeld(group string, held bool) {
+    h.mu.Lock()
+    changed := h.vipHeld[group] != held
+    h.vipHeld[group] = held
+    h.mu.Unlock()
+    
+    if changed {
+        h.SendNow()
+    }
+}
+
+// SetMaintenance sets whether this node advertises itself as in maintenance
+// and therefore ineligible for leadership. Elections and peers are told
+// straight away.
+func (h *Heartbeat) SetMaintenance(enabled bool) {
+    h.mu.Lock()
+    changed := h.maintenance != enabled
+    h.maintenance = enabled
+    h.mu.Unlock()
+    
+    if changed {
+        h.notifySubscribers()
+        h.SendNow()
+    }
+}
+
+// InMaintenance reports whether this node is in maintenance mode
+func (h *Heartbeat) InMaintenance() bool {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    return h.maintenance
+}
+
+// Leave tells peers that this node is shutting down, so that they drop it
+// and elect a new leader at once instead of waiting for it to time out.
+// Call it after the node has released its VIPs and before Stop.
+func (h *Heartbeat) Leave() {
+    h.mu.Lock()
+    h.leaving = true
+    h.mu.Unlock()
+    
+    log.Printf("Heartbeat: Announcing departure to peers")
+    h.send()
+}
+
+// SendNow sends a heartbeat without waiting for the next interval
+func (h *Heartbeat) SendNow() {
+    select {
+    case h.sendNow <- struct{}{}:
+    default:
+        // A send is already pending
+    }
+}
+
 func (h *Heartbeat) Stop() {
     close(h.stopCh)
     if h.conn != nil {
         h.conn.Close()
     }
+    if h.listener != nil {
+        h.listener.Close()
+    }
+    h.closeTLSConns()
+}
+
+// GetRejectStats returns, per source address, the number of heartbeats
+// dropped because they were unsigned, badly signed, replayed or stale.
+func (h *Heartbeat) GetRejectStats() map[string]RejectStats {
+    if h.auth == nil {
+        return map[string]RejectStats{}
+    }
+    return h.auth.stats()
+}
+
+// peerMetricsRetention is how long a peer that has gone silent is still
+// reported in the peer metrics
+const peerMetricsRetention = 15 * time.Minute
+
+// peerAgeMetrics reports the time since each peer's last heartbeat,
+// including peers that have gone silent in the last peerMetricsRetention
+func (h *Heartbeat) peerAgeMetrics() []metrics.Sample {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    
+    samples := make([]metrics.Sample, 0, len(h.lastSeen))
+    for peer, lastSeen := range h.lastSeen {
+        samples = append(samples, metrics.Sample{LabelValues: []string{peer}, Value: time.Since(lastSeen).Seconds()})
+    }
+    return samples
+}
+
+func (h *Heartbeat) peerHealthMetrics() []metrics.Sample {
+    active := h.GetPeers()
+    
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    
+    samples := make([]metrics.Sample, 0, len(h.lastSeen))
+    for peer := range h.lastSeen {
+        value := 0.0
+        if info, ok := active[peer]; ok && info.Healthy {
+            value = 1
+        }
+        samples = append(samples, metrics.Sample{LabelValues: []string{peer}, Value: value})
+    }
+    return samples
 }
 
 func (h *Heartbeat) GetPeers() map[string]PeerInfo {
@@ -190,6 +550,11 @@ func (h *Heartbeat) GetPeers() map[string]PeerInfo {
             delete(h.peers, k)
         }
     }
+    for k, lastSeen := range h.lastSeen {
+        if now.Sub(lastSeen) > peerMetricsRetention {
+            delete(h.lastSeen, k)
+        }
+    }
     
     return copy
 }
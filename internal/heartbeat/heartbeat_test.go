@@ -0,0 +1,54 @@
+package heartbeat
+
+import (
+    "sort"
+    "testing"
+    "time"
+
+    "github.com/2bleere/ha-vip/internal/config"
+    "github.com/2bleere/ha-vip/internal/metrics"
+)
+
+func samplePeers(samples []metrics.Sample) []string {
+    var peers []string
+    for _, s := range samples {
+        peers = append(peers, s.LabelValues[0])
+    }
+    sort.Strings(peers)
+    return peers
+}
+
+func TestPeerMetricsRetention(t *testing.T) {
+    now := time.Now()
+    h := &Heartbeat{
+        cfg: &config.Config{HeartbeatInterval: 1},
+        peers: map[string]PeerInfo{
+            "active": {LastSeen: now, Healthy: true},
+            "silent": {LastSeen: now.Add(-5 * time.Minute), Healthy: true},
+        },
+        lastSeen: map[string]time.Time{
+            "active":  now,
+            "silent":  now.Add(-5 * time.Minute),
+            "gone":    now.Add(-peerMetricsRetention - time.Minute),
+            "spoofed": now.Add(-time.Hour),
+        },
+    }
+
+    // Peers that stopped sending are still reported until the retention
+    // ends, but only active ones count as healthy
+    health := h.peerHealthMetrics()
+    if got := samplePeers(health); len(got) != 2 || got[0] != "active" || got[1] != "silent" {
+        t.Fatalf("peers reported = %v, want [active silent]", got)
+    }
+    for _, s := range health {
+        if want := s.LabelValues[0] == "active"; (s.Value == 1) != want {
+            t.Errorf("peer %s healthy = %v, want %v", s.LabelValues[0], s.Value, want)
+        }
+    }
+    if got := samplePeers(h.peerAgeMetrics()); len(got) != 2 {
+        t.Errorf("peer ages reported for %v, want [active silent]", got)
+    }
+    if _, ok := h.peers["silent"]; ok {
+        t.Error("silent peer still active")
+    }
+}
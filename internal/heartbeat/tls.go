@@ -0,0 +1,265 @@
+package heartbeat
+
+import (
+    "bufio"
+    "crypto/tls"
+    "crypto/x509"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net"
+    "os"
+    "sync"
+    "time"
+
+    "github.com/2bleere/ha-vip/internal/config"
+    "github.com/2bleere/ha-vip/internal/metrics"
+)
+
+// Supported values for config.HeartbeatTransport
+const (
+    TransportUDP = "udp"
+    TransportTLS = "tls"
+)
+
+// newTLSConfig builds the shared client/server TLS configuration used by the
+// TLS heartbeat transport. Both sides must present a certificate signed by
+// the configured CA, so a host without one can neither send nor receive
+// heartbeats.
+func newTLSConfig(cfg *config.Config) (*tls.Config, error) {
+    if cfg.TLSCert == "" || cfg.TLSKey == "" {
+        return nil, errors.New("tls_cert and tls_key are required")
+    }
+    if cfg.TLSCA == "" {
+        return nil, errors.New("tls_ca is required to verify peer certificates")
+    }
+
+    cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+    if err != nil {
+        return nil, fmt.Errorf("failed to load certificate %s: %w", cfg.TLSCert, err)
+    }
+
+    caPEM, err := os.ReadFile(cfg.TLSCA)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read CA bundle %s: %w", cfg.TLSCA, err)
+    }
+    caPool := x509.NewCertPool()
+    if !caPool.AppendCertsFromPEM(caPEM) {
+        return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.TLSCA)
+    }
+
+    tlsConfig := &tls.Config{
+        Certificates: []tls.Certificate{cert},
+        RootCAs:      caPool,
+        ClientCAs:    caPool,
+        // Client certificates are verified in VerifyConnection so that the
+        // same key usage rules apply in both directions
+        ClientAuth: tls.RequireAnyClientCert,
+        MinVersion: tls.VersionTLS12,
+        VerifyConnection: func(cs tls.ConnectionState) error {
+            return verifyPeerChain(cs, caPool)
+        },
+    }
+
+    if cfg.TLSServerName != "" {
+        tlsConfig.ServerName = cfg.TLSServerName
+    } else {
+        // Peers are addressed by IP:port and their certificates rarely carry
+        // IP SANs, so skip the hostname check and rely on VerifyConnection
+        // to validate the chain against the CA bundle
+        tlsConfig.InsecureSkipVerify = true
+    }
+
+    return tlsConfig, nil
+}
+
+// verifyPeerChain checks that the peer presented a certificate chaining up
+// to the configured CA bundle.
+func verifyPeerChain(cs tls.ConnectionState, roots *x509.CertPool) error {
+    if len(cs.PeerCertificates) == 0 {
+        return errors.New("peer presented no certificate")
+    }
+
+    opts := x509.VerifyOptions{
+        Roots:         roots,
+        Intermediates: x509.NewCertPool(),
+        KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+    }
+    for _, cert := range cs.PeerCertificates[1:] {
+        opts.Intermediates.AddCert(cert)
+    }
+
+    if _, err := cs.PeerCertificates[0].Verify(opts); err != nil {
+        return fmt.Errorf("peer certificate %q not trusted: %w", cs.PeerCertificates[0].Subject.CommonName, err)
+    }
+    return nil
+}
+
+// certIdentity holds the node IDs a verified peer certificate vouches for:
+// its common name and DNS names. A nil certIdentity, as for UDP heartbeats,
+// allows any node ID.
+type certIdentity map[string]bool
+
+func newCertIdentity(cert *x509.Certificate) certIdentity {
+    identity := certIdentity{}
+    if cert.Subject.CommonName != "" {
+        identity[cert.Subject.CommonName] = true
+    }
+    for _, name := range cert.DNSNames {
+        identity[name] = true
+    }
+    return identity
+}
+
+func (c certIdentity) allows(nodeID string) bool {
+    return c == nil || c[nodeID]
+}
+
+// listenTLS accepts heartbeat connections from peers. Each connection
+// carries a stream of newline-delimited JSON heartbeat messages.
+func (h *Heartbeat) listenTLS() {
+    ln, err := tls.Listen("tcp", fmt.Sprintf(":%d", h.cfg.Port), h.tlsConfig)
+    if err != nil {
+        log.Printf("Failed to start TLS listener: %v", err)
+        return
+    }
+    h.listener = ln
+
+    for {
+        conn, err := ln.Accept()
+        if err != nil {
+            select {
+            case <-h.stopCh:
+                return
+            default:
+            }
+            log.Printf("TLS accept error: %v", err)
+            time.Sleep(100 * time.Millisecond)
+            continue
+        }
+        go h.serveTLSConn(conn.(*tls.Conn))
+    }
+}
+
+func (h *Heartbeat) serveTLSConn(conn *tls.Conn) {
+    defer conn.Close()
+
+    conn.SetDeadline(time.Now().Add(5 * time.Second))
+    if err := conn.Handshake(); err != nil {
+        log.Printf("Heartbeat: Rejected TLS connection from %s: %v", conn.RemoteAddr(), err)
+        return
+    }
+    // Heartbeats on this connection may only speak for the node named in
+    // the certificate the handshake verified
+    cert := conn.ConnectionState().PeerCertificates[0]
+    identity := newCertIdentity(cert)
+
+    // Drop connections from peers that stop sending for a few intervals
+    idleTimeout := time.Duration(h.cfg.HeartbeatInterval*3) * time.Second
+    if idleTimeout < 5*time.Second {
+        idleTimeout = 5 * time.Second
+    }
+
+    source, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+    reader := bufio.NewReader(conn)
+    for {
+        select {
+        case <-h.stopCh:
+            return
+        default:
+        }
+
+        conn.SetReadDeadline(time.Now().Add(idleTimeout))
+        line, err := reader.ReadBytes('\n')
+        if err != nil {
+            if err != io.EOF {
+                log.Printf("Heartbeat: TLS connection from %s closed: %v", conn.RemoteAddr(), err)
+                metrics.HeartbeatErrors.Inc("receive")
+            }
+            return
+        }
+        if len(line) > 1 {
+            err := h.handleMessage(line[:len(line)-1], source, identity)
+            if err == rejectError(RejectIdentity) {
+                log.Printf("Heartbeat: Closing TLS connection from %s: heartbeat node ID does not match certificate %q",
+                    conn.RemoteAddr(), cert.Subject.CommonName)
+                return
+            }
+        }
+    }
+}
+
+// sendTLS writes the heartbeat to every peer over a persistent TLS
+// connection, dialling (or re-dialling) peers as needed.
+func (h *Heartbeat) sendTLS(msgBytes []byte) {
+    payload := append(msgBytes, '\n')
+
+    var wg sync.WaitGroup
+    for _, peer := range h.cfg.Peers {
+        wg.Add(1)
+        go func(peer string) {
+            defer wg.Done()
+            h.sendTLSToPeer(peer, payload)
+        }(peer)
+    }
+    wg.Wait()
+}
+
+// tlsPeer is the connection to one peer. Its lock is held while sending,
+// dial included, so that concurrent sends share a single connection.
+type tlsPeer struct {
+    mu   sync.Mutex
+    conn *tls.Conn
+}
+
+func (h *Heartbeat) sendTLSToPeer(peer string, payload []byte) {
+    h.mu.Lock()
+    p := h.tlsPeers[peer]
+    if p == nil {
+        p = &tlsPeer{}
+        h.tlsPeers[peer] = p
+    }
+    h.mu.Unlock()
+
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    if p.conn == nil {
+        dialer := &net.Dialer{Timeout: 2 * time.Second}
+        conn, err := tls.DialWithDialer(dialer, "tcp", peer, h.tlsConfig)
+        if err != nil {
+            metrics.HeartbeatsSent.Inc(metrics.ResultFailure)
+            metrics.HeartbeatErrors.Inc("send")
+            return
+        }
+        log.Printf("Heartbeat: Established TLS connection to peer %s", peer)
+        p.conn = conn
+    }
+
+    p.conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
+    if _, err := p.conn.Write(payload); err != nil {
+        log.Printf("Heartbeat: Lost TLS connection to peer %s: %v", peer, err)
+        metrics.HeartbeatsSent.Inc(metrics.ResultFailure)
+        metrics.HeartbeatErrors.Inc("send")
+        p.conn.Close()
+        p.conn = nil
+        return
+    }
+    metrics.HeartbeatsSent.Inc(metrics.ResultSuccess)
+}
+
+func (h *Heartbeat) closeTLSConns() {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    for peer, p := range h.tlsPeers {
+        p.mu.Lock()
+        if p.conn != nil {
+            p.conn.Close()
+            p.conn = nil
+        }
+        p.mu.Unlock()
+        delete(h.tlsPeers, peer)
+    }
+}
@@ -0,0 +1,204 @@
+package heartbeat
+
+import (
+    "bufio"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/json"
+    "math/big"
+    "net"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "github.com/2bleere/ha-vip/internal/config"
+)
+
+func TestCertIdentity(t *testing.T) {
+    identity := newCertIdentity(&x509.Certificate{
+        Subject:  pkix.Name{CommonName: "node1"},
+        DNSNames: []string{"node1.example.com", "ha-vip"},
+    })
+
+    tests := []struct {
+        nodeID string
+        want   bool
+    }{
+        {"node1", true},
+        {"node1.example.com", true},
+        {"ha-vip", true},
+        {"node2", false},
+        {"", false},
+    }
+    for _, tt := range tests {
+        if got := identity.allows(tt.nodeID); got != tt.want {
+            t.Errorf("allows(%q) = %v, want %v", tt.nodeID, got, tt.want)
+        }
+    }
+
+    var udp certIdentity
+    if !udp.allows("node2") {
+        t.Errorf("nil identity rejects node2, want any node ID allowed")
+    }
+}
+
+func TestHandleMessageIdentity(t *testing.T) {
+    heartbeat := func(nodeID string) []byte {
+        data, _ := json.Marshal(HeartbeatMessage{NodeID: nodeID, Priority: 1, Healthy: true})
+        return data
+    }
+
+    tests := []struct {
+        name     string
+        data     []byte
+        identity certIdentity
+        wantErr  bool
+        wantPeer string
+    }{
+        {"matching node ID", heartbeat("node2"), certIdentity{"node2": true}, false, "node2"},
+        {"foreign node ID", heartbeat("node3"), certIdentity{"node2": true}, true, ""},
+        {"UDP allows any node ID", heartbeat("node3"), nil, false, "node3"},
+        {"legacy format with foreign node ID", []byte("node3"), certIdentity{"node2": true}, true, ""},
+        {"legacy format with matching node ID", []byte("node2"), certIdentity{"node2": true}, false, "node2"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            h := &Heartbeat{
+                cfg:      &config.Config{NodeID: "node1"},
+                peers:    make(map[string]PeerInfo),
+                lastSeen: make(map[string]time.Time),
+            }
+            err := h.handleMessage(tt.data, "10.0.0.2", tt.identity)
+            if tt.wantErr != (err == rejectError(RejectIdentity)) {
+                t.Fatalf("handleMessage() error = %v, want identity rejection %v", err, tt.wantErr)
+            }
+            if len(h.peers) > 1 {
+                t.Fatalf("peers = %v, want at most one", h.peers)
+            }
+            if _, ok := h.peers[tt.wantPeer]; tt.wantPeer != "" && !ok {
+                t.Errorf("peers = %v, want %s", h.peers, tt.wantPeer)
+            }
+            if tt.wantPeer == "" && len(h.peers) != 0 {
+                t.Errorf("peers = %v, want none", h.peers)
+            }
+        })
+    }
+}
+
+func TestOpenIdentityDoesNotAdvanceSequence(t *testing.T) {
+    sender := newTestAuthenticator(t, "secret")
+    receiver := newTestAuthenticator(t, "secret")
+
+    // A foreign node speaking for node2 with a far higher sequence number
+    // must not make node2's own heartbeats look like replays
+    forged := resign(t, sender, HeartbeatMessage{NodeID: "node2", Seq: ^uint64(0), Timestamp: time.Now().UnixMilli()})
+    if _, err := receiver.open(forged, "10.0.0.3", certIdentity{"node3": true}); err != rejectError(RejectIdentity) {
+        t.Fatalf("open(forged) error = %v, want %s", err, RejectIdentity)
+    }
+    genuine, _ := sender.seal(HeartbeatMessage{NodeID: "node2"})
+    if _, err := receiver.open(genuine, "10.0.0.2", certIdentity{"node2": true}); err != nil {
+        t.Fatalf("open(genuine) error = %v", err)
+    }
+}
+
+// newTestCert returns a self-signed certificate for 127.0.0.1
+func newTestCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+    t.Helper()
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+    template := &x509.Certificate{
+        SerialNumber:          big.NewInt(1),
+        Subject:               pkix.Name{CommonName: "node2"},
+        IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+        NotBefore:             time.Now().Add(-time.Hour),
+        NotAfter:              time.Now().Add(time.Hour),
+        IsCA:                  true,
+        BasicConstraintsValid: true,
+        KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+        ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+    }
+    der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    cert, err := x509.ParseCertificate(der)
+    if err != nil {
+        t.Fatal(err)
+    }
+    pool := x509.NewCertPool()
+    pool.AddCert(cert)
+    return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestSendTLSToPeerConcurrently(t *testing.T) {
+    cert, pool := newTestCert(t)
+    listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer listener.Close()
+
+    var accepted atomic.Int32
+    lines := make(chan string, 16)
+    go func() {
+        for {
+            conn, err := listener.Accept()
+            if err != nil {
+                return
+            }
+            accepted.Add(1)
+            go func() {
+                defer conn.Close()
+                reader := bufio.NewReader(conn)
+                for {
+                    line, err := reader.ReadString('\n')
+                    if err != nil {
+                        return
+                    }
+                    lines <- line
+                }
+            }()
+        }
+    }()
+
+    peer := listener.Addr().String()
+    h := &Heartbeat{
+        cfg:       &config.Config{Peers: []string{peer}},
+        tlsConfig: &tls.Config{RootCAs: pool},
+        tlsPeers:  make(map[string]*tlsPeer),
+    }
+    defer h.closeTLSConns()
+
+    const sends = 8
+    start := make(chan struct{})
+    var wg sync.WaitGroup
+    for i := 0; i < sends; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            <-start
+            h.sendTLSToPeer(peer, []byte("heartbeat\n"))
+        }()
+    }
+    close(start)
+    wg.Wait()
+
+    for i := 0; i < sends; i++ {
+        select {
+        case <-lines:
+        case <-time.After(2 * time.Second):
+            t.Fatalf("received %d of %d heartbeats", i, sends)
+        }
+    }
+    if n := accepted.Load(); n != 1 {
+        t.Errorf("%d connections dialled, want 1", n)
+    }
+}
+
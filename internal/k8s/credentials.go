@@ -0,0 +1,123 @@
+package k8s
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "log"
+    "net/http"
+    "os"
+    "strings"
+    "time"
+
+    "github.com/2bleere/ha-vip/internal/config"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/rest"
+)
+
+// credentialReloadInterval is how often the token, CA and kubeconfig files
+// are checked for changes
+const credentialReloadInterval = 10 * time.Second
+
+// credentialFiles lists the files the client configuration was built from,
+// so that rotated tokens and CAs are picked up without a restart
+func credentialFiles(k8sCfg config.K8sConfig, restConfig *rest.Config) []string {
+    candidates := []string{
+        k8sCfg.Kubeconfig,
+        k8sCfg.TokenFile,
+        k8sCfg.CACert,
+        restConfig.BearerTokenFile,
+        restConfig.TLSClientConfig.CAFile,
+        restConfig.TLSClientConfig.CertFile,
+        restConfig.TLSClientConfig.KeyFile,
+    }
+
+    var files []string
+    seen := make(map[string]bool)
+    for _, file := range candidates {
+        if file != "" && !seen[file] {
+            seen[file] = true
+            files = append(files, file)
+        }
+    }
+    return files
+}
+
+// fingerprint hashes the contents of the files; a missing file hashes
+// differently from an empty one
+func fingerprint(files []string) string {
+    hash := sha256.New()
+    for _, file := range files {
+        hash.Write([]byte(file))
+        data, err := os.ReadFile(file)
+        if err != nil {
+            hash.Write([]byte{0})
+            continue
+        }
+        hash.Write([]byte{1})
+        hash.Write(data)
+    }
+    return hex.EncodeToString(hash.Sum(nil))
+}
+
+// reloadCredentials rebuilds the clients when a credential file changed.
+// If the new files do not yield a working configuration the previous
+// clients stay in use, and the reload is retried on the next change.
+func (k *K8sHealthChecker) reloadCredentials() {
+    k.mu.RLock()
+    files := k.credentialFiles
+    previous := k.credentialSum
+    k.mu.RUnlock()
+
+    sum := fingerprint(files)
+    if sum == previous {
+        return
+    }
+
+    clients, err := newClients(k.cfg.K8s)
+    if err != nil {
+        log.Printf("K8s credentials changed but could not be loaded, keeping the previous ones: %v", err)
+        k.mu.Lock()
+        k.credentialSum = sum
+        k.mu.Unlock()
+        return
+    }
+
+    k.mu.Lock()
+    oldClient := k.httpClient
+    k.restConfig = clients.restConfig
+    k.client = clients.client
+    k.probeConfig = clients.probeConfig
+    k.probeClient = clients.probeClient
+    k.httpClient = clients.httpClient
+    k.credentialFiles = credentialFiles(k.cfg.K8s, clients.restConfig)
+    k.credentialSum = fingerprint(k.credentialFiles)
+    k.mu.Unlock()
+
+    oldClient.CloseIdleConnections()
+    log.Printf("K8s credentials changed, reloaded them from %s", strings.Join(files, ", "))
+
+    // The node watch keeps the client it was started with
+    if k.cfg.K8s.WatchNode {
+        k.stopNodeWatch()
+        k.startNodeWatch(clients.client)
+    }
+}
+
+// Client returns the Kubernetes client for api_server, which changes when
+// the credentials are reloaded
+func (k *K8sHealthChecker) Client() kubernetes.Interface {
+    if k == nil {
+        return nil
+    }
+    k.mu.RLock()
+    defer k.mu.RUnlock()
+    return k.client
+}
+
+// probeClients returns the configuration and HTTP client currently used
+// for the health probes
+func (k *K8sHealthChecker) probeClients() (*rest.Config, *http.Client) {
+    k.mu.RLock()
+    defer k.mu.RUnlock()
+    return k.probeConfig, k.httpClient
+}
@@ -0,0 +1,120 @@
+package k8s
+
+import (
+    "net/http"
+    "os"
+    "path/filepath"
+    "reflect"
+    "sync"
+    "testing"
+
+    "k8s.io/client-go/rest"
+
+    "github.com/2bleere/ha-vip/internal/config"
+)
+
+func TestCredentialFiles(t *testing.T) {
+    k8sCfg := config.K8sConfig{TokenFile: "/etc/ha-vip/token", CACert: "/etc/ha-vip/ca.crt"}
+    restConfig := &rest.Config{BearerTokenFile: "/etc/ha-vip/token"}
+    restConfig.TLSClientConfig.CertFile = "/etc/ha-vip/client.crt"
+
+    want := []string{"/etc/ha-vip/token", "/etc/ha-vip/ca.crt", "/etc/ha-vip/client.crt"}
+    if got := credentialFiles(k8sCfg, restConfig); !reflect.DeepEqual(got, want) {
+        t.Errorf("credentialFiles() = %v, want %v", got, want)
+    }
+}
+
+func TestFingerprint(t *testing.T) {
+    dir := t.TempDir()
+    file := filepath.Join(dir, "token")
+    files := []string{file}
+
+    missing := fingerprint(files)
+    os.WriteFile(file, nil, 0600)
+    empty := fingerprint(files)
+    if empty == missing {
+        t.Error("an empty file fingerprints like a missing one")
+    }
+
+    os.WriteFile(file, []byte("token-1"), 0600)
+    written := fingerprint(files)
+    if written == empty || fingerprint(files) != written {
+        t.Error("fingerprint does not follow the contents")
+    }
+    if fingerprint([]string{filepath.Join(dir, "other")}) == missing {
+        t.Error("different missing files fingerprint alike")
+    }
+}
+
+func TestReloadCredentials(t *testing.T) {
+    var mu sync.Mutex
+    var authorization string
+    server, caFile := newTestAPIServer(t, func(w http.ResponseWriter, r *http.Request) {
+        mu.Lock()
+        authorization = r.Header.Get("Authorization")
+        mu.Unlock()
+        w.Write([]byte("[+]ping ok\nreadyz check passed\n"))
+    })
+    tokenFile := filepath.Join(t.TempDir(), "token")
+    if err := os.WriteFile(tokenFile, []byte("token-1\n"), 0600); err != nil {
+        t.Fatal(err)
+    }
+    ca, err := os.ReadFile(caFile)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    k := NewK8sHealthChecker(&config.Config{NodeID: "cp-1", K8s: config.K8sConfig{
+        Enabled:   true,
+        APIServer: server.URL,
+        TokenFile: tokenFile,
+        CACert:    caFile,
+    }})
+    if k == nil {
+        t.Fatal("NewK8sHealthChecker() = nil")
+    }
+
+    // probe reports whether the API server is reachable and with which token
+    probe := func() (bool, string) {
+        healthy, _ := k.checkEndpoint(readyzEndpoint)
+        mu.Lock()
+        defer mu.Unlock()
+        sent := authorization
+        authorization = ""
+        return healthy, sent
+    }
+    if healthy, sent := probe(); !healthy || sent != "Bearer token-1" {
+        t.Fatalf("probe = %v with %q, want healthy with token-1", healthy, sent)
+    }
+
+    steps := []struct {
+        name        string
+        file        string
+        contents    []byte // Nil leaves the files alone
+        wantRebuilt bool
+        wantToken   string
+    }{
+        {"unchanged files", "", nil, false, "token-1"},
+        {"rotated token", tokenFile, []byte("token-2\n"), true, "token-2"},
+        {"same token again", tokenFile, []byte("token-2\n"), false, "token-2"},
+        {"unusable CA keeps the clients", caFile, []byte("not a certificate"), false, "token-2"},
+        {"unusable CA is not retried", "", nil, false, "token-2"},
+        {"renewed CA", caFile, append(ca, '\n'), true, "token-2"},
+    }
+    for _, step := range steps {
+        if step.contents != nil {
+            if err := os.WriteFile(step.file, step.contents, 0600); err != nil {
+                t.Fatal(err)
+            }
+        }
+
+        client, httpClient := k.Client(), k.httpClient
+        k.reloadCredentials()
+        if rebuilt := k.Client() != client || k.httpClient != httpClient; rebuilt != step.wantRebuilt {
+            t.Errorf("%s: rebuilt = %v, want %v", step.name, rebuilt, step.wantRebuilt)
+        }
+        if healthy, sent := probe(); !healthy || sent != "Bearer "+step.wantToken {
+            t.Errorf("%s: probe = %v with %q, want healthy with %s", step.name, healthy, sent, step.wantToken)
+        }
+    }
+}
@@ -0,0 +1,197 @@
+package k8s
+
+import (
+    "context"
+    "io"
+    "log"
+    "net/http"
+    "path"
+    "strings"
+    "time"
+
+    "github.com/2bleere/ha-vip/internal/metrics"
+)
+
+// maxEndpointBody bounds how much of a /readyz or /livez response is read
+const maxEndpointBody = 64 * 1024
+
+// EndpointCheck is one of the checks listed by the API server's /readyz or
+// /livez endpoint
+type EndpointCheck struct {
+    Endpoint string `json:"endpoint"`
+    Name     string `json:"name"`
+    Healthy  bool   `json:"healthy"`
+    Critical bool   `json:"critical"`          // Whether a failure fails the endpoint
+    Message  string `json:"message,omitempty"` // Why the check failed, e.g. "reason withheld"
+}
+
+// apiEndpoint is a health endpoint of the API server and the metrics its
+// probes are recorded in
+type apiEndpoint struct {
+    name     string
+    results  *metrics.CounterVec
+    duration *metrics.GaugeVec
+}
+
+var (
+    readyzEndpoint = apiEndpoint{"readyz", metrics.K8sReadyzChecks, metrics.K8sReadyzDuration}
+    livezEndpoint  = apiEndpoint{"livez", metrics.K8sLivezChecks, metrics.K8sLivezDuration}
+)
+
+// checkEndpoint queries an endpoint with ?verbose and reports whether the
+// API server passes it, along with the individual checks. Failed checks
+// that are not critical are tolerated; a failure without a check listing,
+// such as a 401, always fails the endpoint.
+func (k *K8sHealthChecker) checkEndpoint(endpoint apiEndpoint) (bool, []EndpointCheck) {
+    // The HTTP client adds the credentials
+    probeConfig, httpClient := k.probeClients()
+    endpointURL := strings.TrimSuffix(probeConfig.Host, "/") + "/" + endpoint.name + "?verbose"
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+    req, err := http.NewRequestWithContext(ctx, "GET", endpointURL, nil)
+    if err != nil {
+        return false, nil
+    }
+
+    start := time.Now()
+    resp, err := httpClient.Do(req)
+    if err != nil {
+        endpoint.duration.Set(time.Since(start).Seconds())
+        endpoint.results.Inc("error")
+        return false, nil
+    }
+    defer resp.Body.Close()
+
+    body, err := io.ReadAll(io.LimitReader(resp.Body, maxEndpointBody))
+    endpoint.duration.Set(time.Since(start).Seconds())
+    if err != nil {
+        endpoint.results.Inc("error")
+        return false, nil
+    }
+
+    checks := parseVerbose(endpoint.name, string(body))
+    var failed, tolerated []string
+    for i := range checks {
+        checks[i].Critical = k.isCritical(checks[i].Name)
+        switch {
+        case checks[i].Healthy:
+        case checks[i].Critical:
+            failed = append(failed, checks[i].Name)
+        default:
+            tolerated = append(tolerated, checks[i].Name)
+        }
+    }
+
+    switch {
+    case resp.StatusCode == http.StatusOK:
+        endpoint.results.Inc("ok")
+        return true, checks
+    case len(checks) > 0 && len(failed) == 0:
+        endpoint.results.Inc("degraded")
+        return true, checks
+    }
+    endpoint.results.Inc("not_ready")
+
+    // Log details only when unhealthy (for debugging)
+    log.Printf("K8s /%s response for %s: status=%d, API server not ready", endpoint.name, k.cfg.NodeID, resp.StatusCode)
+    if len(failed) > 0 {
+        log.Printf("K8s failed %s checks: %v", endpoint.name, failed)
+    }
+    return false, checks
+}
+
+// parseVerbose parses the check listing of a verbose /readyz or /livez
+// response, lines like "[+]ping ok" and "[-]etcd failed: reason withheld"
+func parseVerbose(endpoint, body string) []EndpointCheck {
+    var checks []EndpointCheck
+    for _, line := range strings.Split(body, "\n") {
+        line = strings.TrimSpace(line)
+        var healthy bool
+        switch {
+        case strings.HasPrefix(line, "[+]"):
+            healthy = true
+        case strings.HasPrefix(line, "[-]"):
+        default:
+            continue
+        }
+
+        name, message, _ := strings.Cut(line[len("[+]"):], " ")
+        check := EndpointCheck{Endpoint: endpoint, Name: name, Healthy: healthy}
+        if !healthy {
+            check.Message = strings.TrimPrefix(message, "failed: ")
+        }
+        checks = append(checks, check)
+    }
+    return checks
+}
+
+// isCritical reports whether a failure of the named check fails its
+// endpoint: every check, or only those in critical_checks when it is set,
+// except the ones in ignored_checks
+func (k *K8sHealthChecker) isCritical(name string) bool {
+    if len(k.cfg.K8s.CriticalChecks) > 0 && !matchesAny(k.cfg.K8s.CriticalChecks, name) {
+        return false
+    }
+    return !matchesAny(k.cfg.K8s.IgnoredChecks, name)
+}
+
+// matchesAny reports whether name matches one of the patterns. A "*" does
+// not cross a "/", except in a trailing "/*", so that "poststarthook/*"
+// also covers checks like "poststarthook/rbac/bootstrap-roles".
+func matchesAny(patterns []string, name string) bool {
+    for _, pattern := range patterns {
+        if matched, _ := path.Match(pattern, name); matched {
+            return true
+        }
+        if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+            // Compare the prefix with as many leading segments of name
+            depth := strings.Count(prefix, "/") + 1
+            if parts := strings.SplitN(name, "/", depth+1); len(parts) > depth {
+                if matched, _ := path.Match(prefix, strings.Join(parts[:depth], "/")); matched {
+                    return true
+                }
+            }
+        }
+    }
+    return false
+}
+
+// setEndpointChecks records the checks of the latest probe, logging the
+// ones that started failing or recovered
+func (k *K8sHealthChecker) setEndpointChecks(checks []EndpointCheck) {
+    k.mu.Lock()
+    previous := k.endpointChecks
+    k.endpointChecks = checks
+    k.mu.Unlock()
+
+    type checkKey struct{ endpoint, name string }
+    wasHealthy := make(map[checkKey]bool, len(previous))
+    for _, check := range previous {
+        wasHealthy[checkKey{check.Endpoint, check.Name}] = check.Healthy
+    }
+
+    for _, check := range checks {
+        key := checkKey{check.Endpoint, check.Name}
+        healthy, known := wasHealthy[key]
+        delete(wasHealthy, key)
+        metrics.K8sAPIServerCheck.SetBool(check.Healthy, check.Endpoint, check.Name)
+
+        switch {
+        case !check.Healthy && (!known || healthy):
+            effect := "critical"
+            if !check.Critical {
+                effect = "ignored"
+            }
+            log.Printf("K8s /%s check %s failed (%s): %s", check.Endpoint, check.Name, effect, check.Message)
+        case check.Healthy && known && !healthy:
+            log.Printf("K8s /%s check %s recovered", check.Endpoint, check.Name)
+        }
+    }
+
+    // Checks that are no longer reported, e.g. because the API server is
+    // unreachable, have no current state
+    for key := range wasHealthy {
+        metrics.K8sAPIServerCheck.Delete(key.endpoint, key.name)
+    }
+}
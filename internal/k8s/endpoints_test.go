@@ -0,0 +1,155 @@
+package k8s
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "testing"
+
+    "k8s.io/client-go/rest"
+
+    "github.com/2bleere/ha-vip/internal/config"
+)
+
+const readyzFailing = `[+]ping ok
+[+]log ok
+[-]etcd failed: reason withheld
+[+]poststarthook/start-apiserver-admission-initializer ok
+[-]poststarthook/rbac/bootstrap-roles failed: not finished
+[-]informer-sync failed: reason withheld
+readyz check failed
+`
+
+func TestParseVerbose(t *testing.T) {
+    tests := []struct {
+        name string
+        body string
+        want []EndpointCheck
+    }{
+        {
+            name: "passing and failing checks",
+            body: readyzFailing,
+            want: []EndpointCheck{
+                {Endpoint: "readyz", Name: "ping", Healthy: true},
+                {Endpoint: "readyz", Name: "log", Healthy: true},
+                {Endpoint: "readyz", Name: "etcd", Message: "reason withheld"},
+                {Endpoint: "readyz", Name: "poststarthook/start-apiserver-admission-initializer", Healthy: true},
+                {Endpoint: "readyz", Name: "poststarthook/rbac/bootstrap-roles", Message: "not finished"},
+                {Endpoint: "readyz", Name: "informer-sync", Message: "reason withheld"},
+            },
+        },
+        {
+            name: "passing with summary line",
+            body: "[+]ping ok\n[+]etcd ok\nreadyz check passed\n",
+            want: []EndpointCheck{
+                {Endpoint: "readyz", Name: "ping", Healthy: true},
+                {Endpoint: "readyz", Name: "etcd", Healthy: true},
+            },
+        },
+        {
+            name: "CRLF line endings and indentation",
+            body: "  [+]ping ok\r\n[-]etcd failed: reason withheld\r\n",
+            want: []EndpointCheck{
+                {Endpoint: "readyz", Name: "ping", Healthy: true},
+                {Endpoint: "readyz", Name: "etcd", Message: "reason withheld"},
+            },
+        },
+        {
+            name: "failure without a message",
+            body: "[-]etcd\n",
+            want: []EndpointCheck{{Endpoint: "readyz", Name: "etcd"}},
+        },
+        {
+            name: "no check listing",
+            body: `{"kind":"Status","status":"Failure","code":401}`,
+            want: nil,
+        },
+        {
+            name: "empty body",
+            body: "",
+            want: nil,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := parseVerbose("readyz", tt.body); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("parseVerbose() = %+v, want %+v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestIsCritical(t *testing.T) {
+    tests := []struct {
+        name     string
+        critical []string
+        ignored  []string
+        check    string
+        want     bool
+    }{
+        {"every check by default", nil, nil, "informer-sync", true},
+        {"ignored check", nil, []string{"informer-sync"}, "informer-sync", false},
+        {"ignored pattern", nil, []string{"poststarthook/*"}, "poststarthook/start-informers", false},
+        {"trailing pattern covers nested checks", nil, []string{"poststarthook/*"}, "poststarthook/rbac/bootstrap-roles", false},
+        {"inner star does not cross a slash", nil, []string{"poststarthook/*-roles"}, "poststarthook/rbac/bootstrap-roles", true},
+        {"pattern does not match its prefix alone", nil, []string{"poststarthook/*"}, "poststarthook", true},
+        {"ignored pattern leaves others", nil, []string{"poststarthook/*"}, "etcd", true},
+        {"critical check", []string{"etcd", "ping"}, nil, "etcd", true},
+        {"not in critical checks", []string{"etcd", "ping"}, nil, "informer-sync", false},
+        {"critical but ignored", []string{"etcd*"}, []string{"etcd-readiness"}, "etcd-readiness", false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            k := &K8sHealthChecker{cfg: &config.Config{K8s: config.K8sConfig{CriticalChecks: tt.critical, IgnoredChecks: tt.ignored}}}
+            if got := k.isCritical(tt.check); got != tt.want {
+                t.Errorf("isCritical(%q) = %v, want %v", tt.check, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestCheckEndpoint(t *testing.T) {
+    tests := []struct {
+        name     string
+        status   int
+        body     string
+        critical []string
+        ignored  []string
+        want     bool
+    }{
+        {"passing", http.StatusOK, "[+]ping ok\n[+]etcd ok\nreadyz check passed\n", nil, nil, true},
+        {"failing critical check", http.StatusInternalServerError, readyzFailing, nil, nil, false},
+        {"only ignored checks fail", http.StatusInternalServerError, readyzFailing, nil,
+            []string{"etcd", "informer-sync", "poststarthook/*"}, true},
+        {"failing check outside critical checks", http.StatusInternalServerError, readyzFailing,
+            []string{"ping", "log"}, nil, true},
+        {"failing critical check among critical checks", http.StatusInternalServerError, readyzFailing,
+            []string{"ping", "etcd"}, nil, false},
+        {"error without check listing", http.StatusUnauthorized, `{"kind":"Status","code":401}`,
+            nil, []string{"*"}, false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                if r.URL.Path != "/readyz" || !r.URL.Query().Has("verbose") {
+                    t.Errorf("requested %s, want /readyz?verbose", r.URL)
+                }
+                w.WriteHeader(tt.status)
+                w.Write([]byte(tt.body))
+            }))
+            defer server.Close()
+
+            k := &K8sHealthChecker{
+                cfg: &config.Config{NodeID: "node1", K8s: config.K8sConfig{
+                    CriticalChecks: tt.critical,
+                    IgnoredChecks:  tt.ignored,
+                }},
+                probeConfig: &rest.Config{Host: server.URL},
+                httpClient:  server.Client(),
+            }
+            if got, _ := k.checkEndpoint(readyzEndpoint); got != tt.want {
+                t.Errorf("checkEndpoint() = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
@@ -1,27 +1,48 @@
 package k8s
 
 import (
-    "context"
-    "crypto/tls"
-    "crypto/x509"
-    "io"
+    "fmt"
     "log"
     "net"
     "net/http"
+    "net/url"
     "os"
     "strings"
     "sync"
     "time"
 
     "github.com/2bleere/ha-vip/internal/config"
+    "github.com/2bleere/ha-vip/internal/metrics"
     "k8s.io/client-go/kubernetes"
     "k8s.io/client-go/rest"
+    "k8s.io/client-go/tools/clientcmd"
 )
 
+// recentCheckLimit is how many raw check results Status reports
+const recentCheckLimit = 30
+
+// HealthCheck is the raw result of one API server health check
+type HealthCheck struct {
+    Time    time.Time `json:"time"`
+    Healthy bool      `json:"healthy"`
+}
+
+// HealthStatus is a snapshot of the checker's state
+type HealthStatus struct {
+    Healthy         bool            `json:"healthy"`
+    Endpoint        string          `json:"endpoint,omitempty"` // API server the probes go to
+    LastStateChange time.Time       `json:"last_state_change,omitempty"`
+    RecentChecks    []HealthCheck   `json:"recent_checks"`
+    Checks          []EndpointCheck `json:"checks,omitempty"` // /readyz and /livez checks of the latest probe
+    Node            *NodeStatus     `json:"node,omitempty"`
+}
+
 type K8sHealthChecker struct {
     cfg               *config.Config
     restConfig        *rest.Config
     client            kubernetes.Interface
+    probeConfig       *rest.Config // Where the health probes go
+    probeClient       kubernetes.Interface
     httpClient        *http.Client
     mu                sync.RWMutex
     healthy           bool
@@ -31,6 +52,14 @@ type K8sHealthChecker struct {
     healthHistory     []bool
     healthChangedAt   time.Time
     lastStateChange   time.Time
+    recentChecks      []HealthCheck
+    endpointChecks    []EndpointCheck
+    node              NodeStatus    // This node's Node object, when watch_node is set
+    nodeStopCh        chan struct{}
+    credentialFiles   []string // Token, CA and kubeconfig files watched for changes
+    credentialSum     string
+    ownership         map[string]*ownershipState // VIP ownership per group, when publish_status is set
+    publishMu         sync.Mutex                 // Serializes publishing
 }
 
 func NewK8sHealthChecker(cfg *config.Config) *K8sHealthChecker {
@@ -40,111 +69,156 @@ func NewK8sHealthChecker(cfg *config.Config) *K8sHealthChecker {
 
     log.Printf("Initializing K8s health checker with in-cluster: %v", cfg.K8s.InCluster)
     
-    var restConfig *rest.Config
-    var err error
+    clients, err := newClients(cfg.K8s)
+    if err != nil {
+        log.Printf("ERROR: Failed to configure the Kubernetes client: %v", err)
+        return nil
+    }
+
+    k := &K8sHealthChecker{
+        cfg:             cfg,
+        restConfig:      clients.restConfig,
+        client:          clients.client,
+        probeConfig:     clients.probeConfig,
+        probeClient:     clients.probeClient,
+        httpClient:      clients.httpClient,
+        stopCh:          make(chan struct{}),
+        healthCh:        make(chan bool, 10), // Increase buffer size to prevent blocking
+        stableHealthy:   true,                // Start with healthy assumption
+        healthHistory:   make([]bool, 0, 3), // Keep last 3 checks for 5-second window
+    }
+    k.node = NodeStatus{Name: cfg.K8s.NodeName, Problems: []string{}}
+    if k.node.Name == "" {
+        k.node.Name, _ = os.Hostname()
+    }
+    k.credentialFiles = credentialFiles(cfg.K8s, clients.restConfig)
+    k.credentialSum = fingerprint(k.credentialFiles)
+    return k
+}
+
+// apiClients are the clients built from one version of the credentials
+type apiClients struct {
+    restConfig  *rest.Config
+    client      kubernetes.Interface
+    probeConfig *rest.Config
+    probeClient kubernetes.Interface
+    httpClient  *http.Client
+}
+
+// newClients builds the client configuration, the Kubernetes client and
+// the HTTP client used for the health probes
+func newClients(k8sCfg config.K8sConfig) (*apiClients, error) {
+    restConfig, err := newRESTConfig(k8sCfg)
+    if err != nil {
+        return nil, err
+    }
 
-    if cfg.K8s.InCluster {
+    // Create Kubernetes client
+    clientset, err := kubernetes.NewForConfig(restConfig)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+    }
+
+    probeConfig, err := newProbeConfig(k8sCfg, restConfig)
+    if err != nil {
+        return nil, err
+    }
+    probeClient := clientset
+    if probeConfig != restConfig {
+        probeClient, err = kubernetes.NewForConfig(probeConfig)
+        if err != nil {
+            return nil, fmt.Errorf("failed to create Kubernetes client for %s: %w", probeConfig.Host, err)
+        }
+    }
+
+    // Create HTTP client for /readyz endpoint. It authenticates like the
+    // Kubernetes client: bearer tokens, client certificates or exec plugins.
+    httpClient, err := rest.HTTPClientFor(probeConfig)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create HTTP client for the API server: %w", err)
+    }
+    httpClient.Timeout = 5 * time.Second
+    return &apiClients{
+        restConfig:  restConfig,
+        client:      clientset,
+        probeConfig: probeConfig,
+        probeClient: probeClient,
+        httpClient:  httpClient,
+    }, nil
+}
+
+// newRESTConfig builds the client configuration from the in-cluster service
+// account, a kubeconfig file, or api_server, token and ca_cert, in that order
+func newRESTConfig(k8sCfg config.K8sConfig) (*rest.Config, error) {
+    if k8sCfg.InCluster {
         // Use in-cluster configuration
         log.Printf("Using in-cluster Kubernetes configuration")
-        restConfig, err = rest.InClusterConfig()
+        restConfig, err := rest.InClusterConfig()
         if err != nil {
-            log.Printf("Failed to create in-cluster config: %v", err)
-            return nil
-        }
-    } else {
-        // Use external configuration
-        log.Printf("Using external Kubernetes configuration with API server: %s", cfg.K8s.APIServer)
-        
-        // Validate configuration
-        if cfg.K8s.APIServer == "" || cfg.K8s.APIServer == "https://YOUR-API-SERVER:6443" {
-            log.Printf("ERROR: K8s API server not properly configured. Please set a real API server URL.")
-            log.Printf("Current value: %s", cfg.K8s.APIServer)
-            return nil
+            return nil, fmt.Errorf("failed to create in-cluster config: %w", err)
         }
+        return restConfig, nil
+    }
 
-        // Create REST config for client-go
-        restConfig = &rest.Config{
-            Host:    cfg.K8s.APIServer,
-            Timeout: 5 * time.Second, // Add explicit timeout
+    if k8sCfg.Kubeconfig != "" {
+        // Use a kubeconfig file, e.g. /etc/kubernetes/admin.conf
+        loadingRules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: k8sCfg.Kubeconfig}
+        overrides := &clientcmd.ConfigOverrides{CurrentContext: k8sCfg.Context}
+        if k8sCfg.APIServer != "" {
+            // Probe a different API server than the kubeconfig names
+            overrides.ClusterInfo.Server = k8sCfg.APIServer
         }
-
-        // Setup authentication
-        if cfg.K8s.Token != "" {
-            restConfig.BearerToken = cfg.K8s.Token
+        restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+        if err != nil {
+            return nil, fmt.Errorf("failed to load kubeconfig %s: %w", k8sCfg.Kubeconfig, err)
         }
-
-        // Setup TLS configuration
-        if cfg.K8s.CACert != "" {
-            caCert, err := os.ReadFile(cfg.K8s.CACert)
-            if err != nil {
-                log.Printf("Warning: Failed to read K8s CA cert %s: %v", cfg.K8s.CACert, err)
-            } else {
-                restConfig.CAData = caCert
-            }
-        } else {
-            // Skip TLS verification if no CA cert provided (not recommended for production)
-            restConfig.Insecure = true
+        restConfig.Timeout = 5 * time.Second
+        contextName := k8sCfg.Context
+        if contextName == "" {
+            contextName = "current context"
         }
+        log.Printf("Using kubeconfig %s (%s) with API server: %s", k8sCfg.Kubeconfig, contextName, restConfig.Host)
+        return restConfig, nil
     }
 
-    // Create Kubernetes client
-    clientset, err := kubernetes.NewForConfig(restConfig)
-    if err != nil {
-        log.Printf("Failed to create Kubernetes client: %v", err)
-        return nil
+    // Use external configuration
+    log.Printf("Using external Kubernetes configuration with API server: %s", k8sCfg.APIServer)
+    
+    // Validate configuration
+    if k8sCfg.APIServer == "" || k8sCfg.APIServer == "https://YOUR-API-SERVER:6443" {
+        return nil, fmt.Errorf("api_server is not set to a real API server URL (current value: %q), set it or kubeconfig", k8sCfg.APIServer)
     }
 
-    // Create HTTP client for /readyz endpoint
-    httpClient := &http.Client{
-        Timeout: 5 * time.Second,
+    // Create REST config for client-go
+    restConfig := &rest.Config{
+        Host:    k8sCfg.APIServer,
+        Timeout: 5 * time.Second, // Add explicit timeout
     }
 
-    // Setup TLS for HTTP client based on the REST config
-    if cfg.K8s.InCluster {
-        // For in-cluster, use the service account's CA
-        if restConfig.CAData != nil {
-            caCertPool := x509.NewCertPool()
-            caCertPool.AppendCertsFromPEM(restConfig.CAData)
-            
-            httpClient.Transport = &http.Transport{
-                TLSClientConfig: &tls.Config{
-                    RootCAs: caCertPool,
-                },
-            }
-        }
-    } else {
-        // For external config, use the configured CA cert
-        if cfg.K8s.CACert != "" {
-            caCert, err := os.ReadFile(cfg.K8s.CACert)
-            if err == nil {
-                caCertPool := x509.NewCertPool()
-                caCertPool.AppendCertsFromPEM(caCert)
-                
-                httpClient.Transport = &http.Transport{
-                    TLSClientConfig: &tls.Config{
-                        RootCAs: caCertPool,
-                    },
-                }
-            }
-        } else {
-            httpClient.Transport = &http.Transport{
-                TLSClientConfig: &tls.Config{
-                    InsecureSkipVerify: true,
-                },
-            }
+    // Setup authentication
+    if k8sCfg.TokenFile != "" {
+        token, err := os.ReadFile(k8sCfg.TokenFile)
+        if err != nil {
+            return nil, fmt.Errorf("failed to read K8s token file: %w", err)
         }
+        restConfig.BearerToken = strings.TrimSpace(string(token))
+    } else if k8sCfg.Token != "" {
+        restConfig.BearerToken = k8sCfg.Token
     }
 
-    return &K8sHealthChecker{
-        cfg:             cfg,
-        restConfig:      restConfig,
-        client:          clientset,
-        httpClient:      httpClient,
-        stopCh:          make(chan struct{}),
-        healthCh:        make(chan bool, 10), // Increase buffer size to prevent blocking
-        stableHealthy:   true,                // Start with healthy assumption
-        healthHistory:   make([]bool, 0, 3), // Keep last 3 checks for 5-second window
+    // Setup TLS configuration
+    if k8sCfg.CACert != "" {
+        caCert, err := os.ReadFile(k8sCfg.CACert)
+        if err != nil {
+            log.Printf("Warning: Failed to read K8s CA cert %s: %v", k8sCfg.CACert, err)
+        } else {
+            restConfig.CAData = caCert
+        }
+    } else {
+        // Skip TLS verification if no CA cert provided (not recommended for production)
+        restConfig.Insecure = true
     }
+    return restConfig, nil
 }
 
 func (k *K8sHealthChecker) Start() {
@@ -154,17 +228,25 @@ func (k *K8sHealthChecker) Start() {
 
     log.Printf("Starting Kubernetes health checker for node %s", k.cfg.NodeID)
 
+    k.startNodeWatch(k.client)
+    defer k.stopNodeWatch()
+
     // Initial health check
     k.checkHealth()
 
     // Start periodic health checking
     ticker := time.NewTicker(2 * time.Second)
     defer ticker.Stop()
+    reloadTicker := time.NewTicker(credentialReloadInterval)
+    defer reloadTicker.Stop()
 
     for {
         select {
         case <-ticker.C:
             k.checkHealth()
+            go k.retryPublish()
+        case <-reloadTicker.C:
+            k.reloadCredentials()
         case <-k.stopCh:
             return
         }
@@ -186,6 +268,11 @@ func (k *K8sHealthChecker) checkHealth() {
     
     now := time.Now()
     
+    k.recentChecks = append(k.recentChecks, HealthCheck{Time: now, Healthy: rawHealthy})
+    if len(k.recentChecks) > recentCheckLimit {
+        k.recentChecks = k.recentChecks[1:]
+    }
+    
     // Add to health history (keep last 3 checks for 5-second window)
     k.healthHistory = append(k.healthHistory, rawHealthy)
     if len(k.healthHistory) > 3 {
@@ -211,6 +298,8 @@ func (k *K8sHealthChecker) checkHealth() {
     oldStableHealthy := k.stableHealthy
     k.stableHealthy = stableHealthy
     k.healthy = stableHealthy
+    // Publish the final state, which may still be reverted below
+    defer func() { metrics.K8sHealthy.SetBool(k.healthy) }()
     
     // Only log and notify when stable health status changes
     if oldStableHealthy != stableHealthy {
@@ -243,36 +332,47 @@ func (k *K8sHealthChecker) performHealthCheck() bool {
 
     // Method 1: Basic connectivity test
     if !k.checkBasicConnectivity() {
+        k.setEndpointChecks(nil)
         return false
     }
 
     // Method 2: /readyz endpoint is the authoritative health check for K8s API
-    readyzHealthy := k.checkReadyzEndpoint()
-    
-    // For HA-VIP purposes, we ONLY trust the /readyz endpoint
     // If /readyz says unhealthy, the API server should not receive traffic
-    if !readyzHealthy {
-        return false
+    healthy, checks := k.checkEndpoint(readyzEndpoint)
+
+    // Method 3: /livez, if enabled, also catches an API server that is
+    // still ready but no longer live
+    if k.cfg.K8s.Livez {
+        livezHealthy, livezChecks := k.checkEndpoint(livezEndpoint)
+        healthy = healthy && livezHealthy
+        checks = append(checks, livezChecks...)
     }
+    k.setEndpointChecks(checks)
 
-    return true
+    // Method 4: the cluster's view of this node, if watched. A cordoned
+    // or drained node gives up the VIP even though its API server is fine.
+    return healthy && k.nodeHealthy()
 }
 
 func (k *K8sHealthChecker) checkBasicConnectivity() bool {
-    // Get the appropriate host for connectivity check
-    var apiURL string
-    if k.cfg.K8s.InCluster {
-        // For in-cluster, use the REST config's host
-        apiURL = strings.TrimPrefix(k.restConfig.Host, "https://")
-        apiURL = strings.TrimPrefix(apiURL, "http://")
-    } else {
-        // For external config, use the configured API server
-        apiURL = strings.TrimPrefix(k.cfg.K8s.APIServer, "https://")
-        apiURL = strings.TrimPrefix(apiURL, "http://")
+    probeConfig, _ := k.probeClients()
+    
+    // Get the host and port of the API server, whichever way it was configured
+    apiURL, err := url.Parse(probeConfig.Host)
+    if err != nil {
+        return false
+    }
+    address := apiURL.Host
+    if apiURL.Port() == "" {
+        port := "443"
+        if apiURL.Scheme == "http" {
+            port = "80"
+        }
+        address = net.JoinHostPort(apiURL.Hostname(), port)
     }
     
     // Simple TCP connectivity test
-    conn, err := net.DialTimeout("tcp", apiURL, 2*time.Second)
+    conn, err := net.DialTimeout("tcp", address, 2*time.Second)
     if err != nil {
         return false
     }
@@ -295,7 +395,10 @@ func (k *K8sHealthChecker) checkClientGo() bool {
         }()
         
         // Try to get server version as a health check
-        _, err = k.client.Discovery().ServerVersion()
+        k.mu.RLock()
+        client := k.probeClient
+        k.mu.RUnlock()
+        _, err = client.Discovery().ServerVersion()
         done <- err == nil
     }()
     
@@ -312,86 +415,38 @@ func (k *K8sHealthChecker) checkClientGo() bool {
     }
 }
 
-func (k *K8sHealthChecker) checkReadyzEndpoint() bool {
-    // Construct readyz URL
-    var readyzURL string
-    if k.cfg.K8s.InCluster {
-        // For in-cluster, use the REST config's host
-        readyzURL = strings.TrimSuffix(k.restConfig.Host, "/") + "/readyz"
-    } else {
-        // For external config, use the configured API server
-        readyzURL = strings.TrimSuffix(k.cfg.K8s.APIServer, "/") + "/readyz"
-    }
-    
-    req, err := http.NewRequest("GET", readyzURL, nil)
-    if err != nil {
-        return false
-    }
-
-    // Add authorization header
-    if k.cfg.K8s.InCluster {
-        // For in-cluster, use the token from REST config
-        if k.restConfig.BearerToken != "" {
-            req.Header.Set("Authorization", "Bearer "+k.restConfig.BearerToken)
-        }
-    } else {
-        // For external config, use the configured token
-        if k.cfg.K8s.Token != "" {
-            req.Header.Set("Authorization", "Bearer "+k.cfg.K8s.Token)
-        }
-    }
-
-    // Add timeout to the request context
-    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-    defer cancel()
-    req = req.WithContext(ctx)
-
-    resp, err := k.httpClient.Do(req)
-    if err != nil {
-        return false
-    }
-    defer resp.Body.Close()
-
-    // Read response body
-    body, err := io.ReadAll(resp.Body)
-    if err != nil {
+func (k *K8sHealthChecker) IsHealthy() bool {
+    if k == nil {
         return false
     }
-
-    bodyStr := strings.TrimSpace(string(body))
     
-    // Check if the API server is ready
-    if resp.StatusCode == 200 && bodyStr == "ok" {
-        return true
-    }
-
-    // Log details only when unhealthy (for debugging)
-    log.Printf("K8s /readyz response for %s: status=%d, API server not ready", k.cfg.NodeID, resp.StatusCode)
-    
-    // Check for specific failure indicators
-    lines := strings.Split(bodyStr, "\n")
-    failedChecks := []string{}
-    for _, line := range lines {
-        if strings.HasPrefix(line, "[-]") {
-            failedChecks = append(failedChecks, strings.TrimPrefix(line, "[-]"))
-        }
-    }
-    
-    if len(failedChecks) > 0 {
-        log.Printf("K8s failed readiness checks: %v", failedChecks)
-    }
-    
-    return false
+    k.mu.RLock()
+    defer k.mu.RUnlock()
+    return k.healthy
 }
 
-func (k *K8sHealthChecker) IsHealthy() bool {
+// Status returns the stable health and the most recent raw check results
+func (k *K8sHealthChecker) Status() HealthStatus {
     if k == nil {
-        return false
+        return HealthStatus{}
     }
     
     k.mu.RLock()
     defer k.mu.RUnlock()
-    return k.healthy
+    var node *NodeStatus
+    if k.cfg.K8s.WatchNode {
+        snapshot := k.node
+        snapshot.Problems = append([]string{}, k.node.Problems...)
+        node = &snapshot
+    }
+    return HealthStatus{
+        Healthy:         k.healthy,
+        Endpoint:        k.probeConfig.Host,
+        LastStateChange: k.lastStateChange,
+        RecentChecks:    append([]HealthCheck(nil), k.recentChecks...),
+        Checks:          append([]EndpointCheck(nil), k.endpointChecks...),
+        Node:            node,
+    }
 }
 
 func (k *K8sHealthChecker) GetHealthChangeChan() <-chan bool {
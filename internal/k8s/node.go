@@ -0,0 +1,150 @@
+package k8s
+
+import (
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/2bleere/ha-vip/internal/metrics"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/fields"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/tools/cache"
+)
+
+// nodeResync is how often the watched Node object is re-evaluated even
+// without changes
+const nodeResync = 5 * time.Minute
+
+// pressureConditions are the node conditions that make a node unhealthy
+// while they are True
+var pressureConditions = []corev1.NodeConditionType{
+    corev1.NodeMemoryPressure,
+    corev1.NodeDiskPressure,
+    corev1.NodePIDPressure,
+}
+
+// NodeStatus is the state of this node's Node object
+type NodeStatus struct {
+    Name       string    `json:"name"`
+    Synced     bool      `json:"synced"`   // Whether the Node object has been seen
+    Problems   []string  `json:"problems"` // Why the node is unhealthy, empty while it is healthy
+    LastChange time.Time `json:"last_change,omitempty"`
+}
+
+// startNodeWatch watches this node's Node object with the given client
+// until stopNodeWatch is called. Problems found in the object make the
+// node unhealthy; while the object cannot be read, the last known state is
+// kept, since the API server checks already cover an unreachable cluster.
+func (k *K8sHealthChecker) startNodeWatch(client kubernetes.Interface) {
+    if !k.cfg.K8s.WatchNode {
+        return
+    }
+
+    name := k.node.Name
+    listWatch := cache.NewListWatchFromClient(client.CoreV1().RESTClient(), "nodes", "",
+        fields.OneTermEqualSelector("metadata.name", name))
+    informer := cache.NewSharedInformer(listWatch, &corev1.Node{}, nodeResync)
+    informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+        log.Printf("K8s watch of node %s failed: %v", name, err)
+    })
+    informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+        AddFunc: func(obj interface{}) {
+            k.setNodeProblems(k.nodeProblems(obj.(*corev1.Node)))
+        },
+        UpdateFunc: func(_, obj interface{}) {
+            k.setNodeProblems(k.nodeProblems(obj.(*corev1.Node)))
+        },
+        DeleteFunc: func(interface{}) {
+            k.setNodeProblems([]string{"Node object deleted"})
+        },
+    })
+
+    stopCh := make(chan struct{})
+    k.mu.Lock()
+    k.nodeStopCh = stopCh
+    k.mu.Unlock()
+    go informer.Run(stopCh)
+    log.Printf("Watching Kubernetes node %s", name)
+}
+
+// stopNodeWatch stops the current watch, if any
+func (k *K8sHealthChecker) stopNodeWatch() {
+    k.mu.Lock()
+    defer k.mu.Unlock()
+    if k.nodeStopCh != nil {
+        close(k.nodeStopCh)
+        k.nodeStopCh = nil
+    }
+}
+
+// nodeProblems lists why the cluster considers the node unfit to hold the
+// VIP
+func (k *K8sHealthChecker) nodeProblems(node *corev1.Node) []string {
+    problems := []string{}
+    notReady := "NotReady" // Also when the node has not reported yet
+    for _, condition := range node.Status.Conditions {
+        switch {
+        case condition.Type == corev1.NodeReady && condition.Status == corev1.ConditionTrue:
+            notReady = ""
+        case condition.Type == corev1.NodeReady && condition.Reason != "":
+            notReady = "NotReady (" + condition.Reason + ")"
+        case isPressure(condition.Type) && condition.Status == corev1.ConditionTrue:
+            problems = append(problems, string(condition.Type))
+        }
+    }
+    if notReady != "" {
+        problems = append([]string{notReady}, problems...)
+    }
+
+    if node.Spec.Unschedulable {
+        problems = append(problems, "cordoned")
+    }
+    for _, taint := range node.Spec.Taints {
+        if matchesAny(k.cfg.K8s.UnhealthyTaints, taint.Key) {
+            problems = append(problems, fmt.Sprintf("tainted %s", taint.ToString()))
+        }
+    }
+    return problems
+}
+
+func isPressure(conditionType corev1.NodeConditionType) bool {
+    for _, pressure := range pressureConditions {
+        if conditionType == pressure {
+            return true
+        }
+    }
+    return false
+}
+
+func (k *K8sHealthChecker) setNodeProblems(problems []string) {
+    k.mu.Lock()
+    previous := strings.Join(k.node.Problems, ", ")
+    wasSynced := k.node.Synced
+    k.node.Problems = problems
+    k.node.Synced = true
+    changed := !wasSynced || previous != strings.Join(problems, ", ")
+    if changed {
+        k.node.LastChange = time.Now()
+    }
+    name := k.node.Name
+    k.mu.Unlock()
+
+    metrics.K8sNodeHealthy.SetBool(len(problems) == 0)
+    switch {
+    case !changed:
+    case len(problems) > 0:
+        log.Printf("K8s node %s is unfit to hold the VIP: %s", name, strings.Join(problems, ", "))
+    case wasSynced:
+        log.Printf("K8s node %s is fit to hold the VIP again", name)
+    }
+}
+
+// nodeHealthy reports whether the Node object has no problems. A node
+// that has not been seen yet counts as healthy.
+func (k *K8sHealthChecker) nodeHealthy() bool {
+    k.mu.RLock()
+    defer k.mu.RUnlock()
+    return len(k.node.Problems) == 0
+}
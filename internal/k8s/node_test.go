@@ -0,0 +1,91 @@
+package k8s
+
+import (
+    "reflect"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+
+    "github.com/2bleere/ha-vip/internal/config"
+)
+
+func TestNodeProblems(t *testing.T) {
+    ready := corev1.NodeCondition{Type: corev1.NodeReady, Status: corev1.ConditionTrue}
+    condition := func(conditionType corev1.NodeConditionType, status corev1.ConditionStatus) corev1.NodeCondition {
+        return corev1.NodeCondition{Type: conditionType, Status: status}
+    }
+
+    tests := []struct {
+        name       string
+        conditions []corev1.NodeCondition
+        cordoned   bool
+        taints     []corev1.Taint
+        want       []string
+    }{
+        {"ready", []corev1.NodeCondition{ready}, false, nil, []string{}},
+        {"no conditions reported yet", nil, false, nil, []string{"NotReady"}},
+        {"not ready", []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionFalse,
+            Reason: "KubeletNotReady"}}, false, nil, []string{"NotReady (KubeletNotReady)"}},
+        {"ready status unknown", []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionUnknown,
+            Reason: "NodeStatusUnknown"}}, false, nil, []string{"NotReady (NodeStatusUnknown)"}},
+        {"pressure", []corev1.NodeCondition{ready,
+            condition(corev1.NodeMemoryPressure, corev1.ConditionTrue),
+            condition(corev1.NodeDiskPressure, corev1.ConditionFalse),
+            condition(corev1.NodePIDPressure, corev1.ConditionTrue)}, false, nil,
+            []string{"MemoryPressure", "PIDPressure"}},
+        {"other conditions are ignored", []corev1.NodeCondition{ready,
+            condition(corev1.NodeNetworkUnavailable, corev1.ConditionTrue)}, false, nil, []string{}},
+        {"not ready comes first", []corev1.NodeCondition{
+            condition(corev1.NodeDiskPressure, corev1.ConditionTrue),
+            condition(corev1.NodeReady, corev1.ConditionFalse)}, false, nil, []string{"NotReady", "DiskPressure"}},
+        {"cordoned", []corev1.NodeCondition{ready}, true, nil, []string{"cordoned"}},
+        {"matching taints", []corev1.NodeCondition{ready}, false, []corev1.Taint{
+            {Key: "node.kubernetes.io/out-of-service", Effect: corev1.TaintEffectNoExecute},
+            {Key: "example.com/maintenance", Value: "true", Effect: corev1.TaintEffectNoSchedule},
+        }, []string{"tainted node.kubernetes.io/out-of-service:NoExecute", "tainted example.com/maintenance=true:NoSchedule"}},
+        {"other taints are ignored", []corev1.NodeCondition{ready}, false, []corev1.Taint{
+            {Key: "node-role.kubernetes.io/control-plane", Effect: corev1.TaintEffectNoSchedule},
+        }, []string{}},
+        {"everything at once", []corev1.NodeCondition{condition(corev1.NodeMemoryPressure, corev1.ConditionTrue)}, true,
+            []corev1.Taint{{Key: "example.com/maintenance", Effect: corev1.TaintEffectNoSchedule}},
+            []string{"NotReady", "MemoryPressure", "cordoned", "tainted example.com/maintenance:NoSchedule"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg := &config.Config{}
+            cfg.K8s.UnhealthyTaints = []string{"node.kubernetes.io/out-of-service", "example.com/*"}
+            k := &K8sHealthChecker{cfg: cfg}
+
+            node := &corev1.Node{
+                Spec:   corev1.NodeSpec{Unschedulable: tt.cordoned, Taints: tt.taints},
+                Status: corev1.NodeStatus{Conditions: tt.conditions},
+            }
+            if got := k.nodeProblems(node); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("nodeProblems() = %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestSetNodeProblems(t *testing.T) {
+    k := &K8sHealthChecker{cfg: &config.Config{}, node: NodeStatus{Name: "cp-1"}}
+    if !k.nodeHealthy() {
+        t.Error("node not seen yet is unhealthy")
+    }
+
+    k.setNodeProblems([]string{"cordoned"})
+    if k.nodeHealthy() || !k.node.Synced || k.node.LastChange.IsZero() {
+        t.Errorf("after a problem: healthy = %v, node = %+v", k.nodeHealthy(), k.node)
+    }
+    changed := k.node.LastChange
+
+    k.setNodeProblems([]string{"cordoned"})
+    if !k.node.LastChange.Equal(changed) {
+        t.Error("LastChange moved without a change")
+    }
+
+    k.setNodeProblems([]string{})
+    if !k.nodeHealthy() {
+        t.Error("node with no problems is unhealthy")
+    }
+}
@@ -0,0 +1,81 @@
+package k8s
+
+import (
+    "fmt"
+    "log"
+    "net"
+    "net/url"
+    "os"
+    "strings"
+
+    "github.com/2bleere/ha-vip/internal/config"
+    "k8s.io/client-go/rest"
+)
+
+// apiServerManifest is the static pod manifest kubeadm writes for the
+// kube-apiserver of a control-plane node
+var apiServerManifest = "/etc/kubernetes/manifests/kube-apiserver.yaml"
+
+// defaultSecurePort is the kube-apiserver port when the manifest does not
+// set one, and the port k3s and RKE2 listen on
+const defaultSecurePort = "6443"
+
+// newProbeConfig returns the configuration the health probes use: the
+// client configuration itself, or a copy pointed at the API server on this
+// host when probe_url is set. The copy keeps the credentials and verifies
+// the server certificate against probe_server_name, since it is usually not
+// issued for 127.0.0.1.
+func newProbeConfig(k8sCfg config.K8sConfig, restConfig *rest.Config) (*rest.Config, error) {
+    if k8sCfg.ProbeURL == "" {
+        return restConfig, nil
+    }
+
+    probeURL := k8sCfg.ProbeURL
+    if probeURL == "auto" {
+        probeURL = discoverLocalAPIServer()
+    }
+    parsed, err := url.Parse(probeURL)
+    if err != nil || parsed.Host == "" {
+        return nil, fmt.Errorf("invalid probe_url %q", probeURL)
+    }
+
+    serverName := k8sCfg.ProbeServerName
+    if serverName == "" {
+        if apiURL, err := url.Parse(restConfig.Host); err == nil {
+            serverName = apiURL.Hostname()
+        }
+    }
+
+    probeConfig := rest.CopyConfig(restConfig)
+    probeConfig.Host = probeURL
+    probeConfig.TLSClientConfig.ServerName = serverName
+    log.Printf("Probing the local API server at %s (certificate name: %s)", probeURL, serverName)
+    return probeConfig, nil
+}
+
+// discoverLocalAPIServer finds the address of the kube-apiserver on this
+// host from its static pod manifest, falling back to 127.0.0.1:6443
+func discoverLocalAPIServer() string {
+    host, port := "127.0.0.1", defaultSecurePort
+
+    data, err := os.ReadFile(apiServerManifest)
+    if err != nil {
+        log.Printf("No kube-apiserver manifest at %s, assuming the API server listens on %s",
+            apiServerManifest, net.JoinHostPort(host, port))
+        return "https://" + net.JoinHostPort(host, port)
+    }
+    for _, line := range strings.Split(string(data), "\n") {
+        arg := strings.Trim(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "- ")), `"'`)
+        switch {
+        case strings.HasPrefix(arg, "--secure-port="):
+            port = strings.TrimPrefix(arg, "--secure-port=")
+        case strings.HasPrefix(arg, "--bind-address="):
+            // A wildcard bind address is reachable on loopback
+            if bind := strings.TrimPrefix(arg, "--bind-address="); bind != "0.0.0.0" && bind != "::" && bind != "" {
+                host = bind
+            }
+        }
+    }
+    log.Printf("Found the local kube-apiserver on %s in %s", net.JoinHostPort(host, port), apiServerManifest)
+    return "https://" + net.JoinHostPort(host, port)
+}
@@ -0,0 +1,167 @@
+package k8s
+
+import (
+    "encoding/pem"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+
+    "k8s.io/client-go/rest"
+
+    "github.com/2bleere/ha-vip/internal/config"
+)
+
+// newTestAPIServer starts a TLS server standing in for the kube-apiserver
+// and returns it with a file holding its CA. Its certificate is issued for
+// example.com and 127.0.0.1.
+func newTestAPIServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, string) {
+    t.Helper()
+    server := httptest.NewTLSServer(handler)
+    t.Cleanup(server.Close)
+
+    caFile := filepath.Join(t.TempDir(), "ca.crt")
+    ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+    if err := os.WriteFile(caFile, ca, 0600); err != nil {
+        t.Fatal(err)
+    }
+    return server, caFile
+}
+
+// useManifest points discoverLocalAPIServer at a manifest with the given
+// contents, or at a missing file when it is empty
+func useManifest(t *testing.T, contents string) {
+    t.Helper()
+    manifest := filepath.Join(t.TempDir(), "kube-apiserver.yaml")
+    if contents != "" {
+        if err := os.WriteFile(manifest, []byte(contents), 0600); err != nil {
+            t.Fatal(err)
+        }
+    }
+    previous := apiServerManifest
+    apiServerManifest = manifest
+    t.Cleanup(func() { apiServerManifest = previous })
+}
+
+func TestDiscoverLocalAPIServer(t *testing.T) {
+    tests := []struct {
+        name     string
+        manifest string
+        want     string
+    }{
+        {"no manifest", "", "https://127.0.0.1:6443"},
+        {"kubeadm", `spec:
+  containers:
+  - command:
+    - kube-apiserver
+    - --advertise-address=192.168.1.11
+    - --secure-port=6443
+    - --bind-address=192.168.1.11
+`, "https://192.168.1.11:6443"},
+        {"quoted arguments", `    - "--secure-port=8443"
+    - '--bind-address=10.0.0.5'
+`, "https://10.0.0.5:8443"},
+        {"wildcard bind address", "    - --bind-address=0.0.0.0\n    - --secure-port=7443\n", "https://127.0.0.1:7443"},
+        {"IPv6 bind address", "    - --bind-address=fd00::11\n", "https://[fd00::11]:6443"},
+        {"IPv6 wildcard", "    - --bind-address=::\n", "https://127.0.0.1:6443"},
+        {"no flags", "spec: {}\n", "https://127.0.0.1:6443"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            useManifest(t, tt.manifest)
+            if got := discoverLocalAPIServer(); got != tt.want {
+                t.Errorf("discoverLocalAPIServer() = %s, want %s", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestNewProbeConfig(t *testing.T) {
+    restConfig := &rest.Config{Host: "https://api.example.com:6443", BearerToken: "secret"}
+
+    probeConfig, err := newProbeConfig(config.K8sConfig{}, restConfig)
+    if err != nil || probeConfig != restConfig {
+        t.Errorf("without probe_url: %v, %v, want the client configuration", probeConfig, err)
+    }
+
+    probeConfig, err = newProbeConfig(config.K8sConfig{ProbeURL: "https://127.0.0.1:6443"}, restConfig)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if probeConfig.Host != "https://127.0.0.1:6443" || probeConfig.ServerName != "api.example.com" ||
+        probeConfig.BearerToken != "secret" {
+        t.Errorf("probe config = %s (server name %s), want 127.0.0.1 verified as api.example.com with the token",
+            probeConfig.Host, probeConfig.ServerName)
+    }
+    if restConfig.ServerName != "" {
+        t.Errorf("client configuration changed: server name %s", restConfig.ServerName)
+    }
+
+    if _, err := newProbeConfig(config.K8sConfig{ProbeURL: "127.0.0.1:6443"}, restConfig); err == nil {
+        t.Error("probe_url without a scheme accepted")
+    }
+}
+
+func TestProbeLocalAPIServer(t *testing.T) {
+    server, caFile := newTestAPIServer(t, func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path != "/readyz" || !r.URL.Query().Has("verbose") {
+            t.Errorf("requested %s, want /readyz?verbose", r.URL)
+        }
+        w.WriteHeader(http.StatusInternalServerError)
+        w.Write([]byte(readyzFailing))
+    })
+    _, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+    want := []EndpointCheck{
+        {Endpoint: "readyz", Name: "ping", Healthy: true, Critical: true},
+        {Endpoint: "readyz", Name: "log", Healthy: true},
+        {Endpoint: "readyz", Name: "etcd", Healthy: false, Critical: true, Message: "reason withheld"},
+        {Endpoint: "readyz", Name: "poststarthook/start-apiserver-admission-initializer", Healthy: true},
+        {Endpoint: "readyz", Name: "poststarthook/rbac/bootstrap-roles", Healthy: false, Message: "not finished"},
+        {Endpoint: "readyz", Name: "informer-sync", Healthy: false, Message: "reason withheld"},
+    }
+
+    tests := []struct {
+        name       string
+        apiServer  string
+        serverName string
+        wantChecks bool
+    }{
+        {"certificate name from api_server", "https://example.com:6443", "", true},
+        {"probe_server_name", "https://vip.internal:6443", "example.com", true},
+        {"certificate not issued for the name", "https://vip.internal:6443", "", false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            useManifest(t, "    - --secure-port="+port+"\n    - --bind-address=127.0.0.1\n")
+            cfg := &config.Config{NodeID: "cp-1", K8s: config.K8sConfig{
+                Enabled:         true,
+                APIServer:       tt.apiServer,
+                CACert:          caFile,
+                ProbeURL:        "auto",
+                ProbeServerName: tt.serverName,
+                CriticalChecks:  []string{"etcd", "ping"},
+            }}
+            k := NewK8sHealthChecker(cfg)
+            if k == nil {
+                t.Fatal("NewK8sHealthChecker() = nil")
+            }
+            if k.probeConfig.Host != server.URL {
+                t.Fatalf("probing %s, want %s", k.probeConfig.Host, server.URL)
+            }
+
+            healthy, checks := k.checkEndpoint(readyzEndpoint)
+            if healthy {
+                t.Error("checkEndpoint() = healthy with etcd failing")
+            }
+            if tt.wantChecks && !reflect.DeepEqual(checks, want) {
+                t.Errorf("checks = %+v, want %+v", checks, want)
+            }
+            if !tt.wantChecks && checks != nil {
+                t.Errorf("checks = %+v from a server that failed verification", checks)
+            }
+        })
+    }
+}
@@ -0,0 +1,301 @@
+package k8s
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+    "k8s.io/client-go/util/retry"
+)
+
+// Defaults and names used to publish VIP ownership
+const (
+    defaultStatusConfigMap = "ha-vip-status"
+    defaultStatusNamespace = "kube-system"
+    // annotationPrefix is followed by the group name on the Node object of
+    // the node holding the group's VIPs
+    annotationPrefix = "vip.ha-vip.io/"
+    // eventNamespace is where Events about cluster-scoped Node objects go;
+    // the API server rejects them in any other namespace
+    eventNamespace = "default"
+    publishTimeout = 5 * time.Second
+)
+
+// VIPOwnership is whether this node holds the VIPs of a group, as
+// published to Kubernetes
+type VIPOwnership struct {
+    Group string
+    VIPs  []string
+    Held  bool
+    Term  uint64
+    Since time.Time // When the VIPs were taken or released
+}
+
+// ownershipRecord is the value of the group's entry in the status
+// ConfigMap and of its annotation on the Node object
+type ownershipRecord struct {
+    Node  string    `json:"node"`
+    VIPs  []string  `json:"vips"`
+    Term  uint64    `json:"term"`
+    Since time.Time `json:"since"`
+}
+
+// ownershipState tracks publishing for one group
+type ownershipState struct {
+    desired   VIPOwnership
+    published *VIPOwnership // Last state published in full
+    pending   bool
+    lastError string
+}
+
+// PublishVIP records in Kubernetes whether this node holds the VIPs of a
+// group: the node annotates its Node object and the group's entry of the
+// status ConfigMap while it holds them, and records an Event when it takes
+// or releases them. Publishing runs in the background and is retried until
+// it succeeds; it does nothing unless publish_status is set.
+func (k *K8sHealthChecker) PublishVIP(ownership VIPOwnership) {
+    if k == nil || !k.cfg.K8s.PublishStatus {
+        return
+    }
+
+    k.mu.Lock()
+    if k.ownership == nil {
+        k.ownership = make(map[string]*ownershipState)
+    }
+    state := k.ownership[ownership.Group]
+    if state == nil {
+        state = &ownershipState{}
+        k.ownership[ownership.Group] = state
+    }
+    state.desired = ownership
+    state.pending = true
+    k.mu.Unlock()
+
+    go k.PublishPending()
+}
+
+// PublishPending publishes every group whose ownership has not been
+// published yet. It is also called on shutdown to record the released VIPs
+// before exiting.
+func (k *K8sHealthChecker) PublishPending() {
+    if k == nil || !k.cfg.K8s.PublishStatus {
+        return
+    }
+
+    k.publishMu.Lock()
+    defer k.publishMu.Unlock()
+    k.publishPending()
+}
+
+// retryPublish retries failed publishing on every health check, unless
+// publishing is already in progress
+func (k *K8sHealthChecker) retryPublish() {
+    if !k.cfg.K8s.PublishStatus || !k.publishMu.TryLock() {
+        return
+    }
+    defer k.publishMu.Unlock()
+    k.publishPending()
+}
+
+// publishPending is called with publishMu held
+func (k *K8sHealthChecker) publishPending() {
+    k.mu.RLock()
+    var pending []VIPOwnership
+    for _, state := range k.ownership {
+        if state.pending {
+            pending = append(pending, state.desired)
+        }
+    }
+    k.mu.RUnlock()
+
+    for _, ownership := range pending {
+        k.mu.RLock()
+        previous := k.ownership[ownership.Group].published
+        k.mu.RUnlock()
+
+        err := k.publish(ownership, previous)
+
+        k.mu.Lock()
+        state := k.ownership[ownership.Group]
+        failed := ""
+        if err != nil {
+            failed = err.Error()
+        } else {
+            published := ownership
+            state.published = &published
+            // A newer state may have arrived while this one was published
+            state.pending = !sameOwnership(state.desired, ownership)
+        }
+        logged := state.lastError
+        state.lastError = failed
+        k.mu.Unlock()
+
+        switch {
+        case err != nil && failed != logged:
+            log.Printf("K8s: failed to publish VIP ownership of group %s: %v", ownership.Group, err)
+        case err == nil && logged != "":
+            log.Printf("K8s: published VIP ownership of group %s again", ownership.Group)
+        }
+    }
+}
+
+// publish annotates the Node object, updates the status ConfigMap and
+// records an Event, in that order, so that a retry after a failure does
+// not record the Event twice
+func (k *K8sHealthChecker) publish(ownership VIPOwnership, previous *VIPOwnership) error {
+    ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+    defer cancel()
+
+    record := ownershipRecord{Node: k.node.Name, VIPs: ownership.VIPs, Term: ownership.Term,
+        Since: ownership.Since.UTC().Truncate(time.Second)}
+    if err := k.annotateNode(ctx, ownership, record); err != nil {
+        return fmt.Errorf("annotate node %s: %w", k.node.Name, err)
+    }
+    if err := k.updateStatusConfigMap(ctx, ownership, record); err != nil {
+        return fmt.Errorf("update ConfigMap %s: %w", k.statusConfigMapRef(), err)
+    }
+
+    // Nothing happened when a node starts without the VIPs
+    wasHeld := previous != nil && previous.Held
+    if ownership.Held == wasHeld {
+        return nil
+    }
+    if err := k.recordEvent(ctx, ownership); err != nil {
+        return fmt.Errorf("record event: %w", err)
+    }
+    return nil
+}
+
+// annotateNode sets the group's annotation on this node's Node object
+// while the VIPs are held and removes it otherwise
+func (k *K8sHealthChecker) annotateNode(ctx context.Context, ownership VIPOwnership, record ownershipRecord) error {
+    var value interface{} // null removes the annotation
+    if ownership.Held {
+        data, err := json.Marshal(record)
+        if err != nil {
+            return err
+        }
+        value = string(data)
+    }
+    patch, err := json.Marshal(map[string]interface{}{
+        "metadata": map[string]interface{}{
+            "annotations": map[string]interface{}{annotationPrefix + ownership.Group: value},
+        },
+    })
+    if err != nil {
+        return err
+    }
+    _, err = k.Client().CoreV1().Nodes().Patch(ctx, k.node.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+    return err
+}
+
+// updateStatusConfigMap sets the group's entry in the status ConfigMap
+// while the VIPs are held. On release the entry is only removed while it
+// still names this node, so that it never erases the new holder's entry.
+func (k *K8sHealthChecker) updateStatusConfigMap(ctx context.Context, ownership VIPOwnership, record ownershipRecord) error {
+    configMaps := k.Client().CoreV1().ConfigMaps(k.statusNamespace())
+    name := k.statusConfigMapName()
+    data, err := json.Marshal(record)
+    if err != nil {
+        return err
+    }
+
+    return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+        configMap, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+        if apierrors.IsNotFound(err) {
+            if !ownership.Held {
+                return nil
+            }
+            configMap = &corev1.ConfigMap{
+                ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: k.statusNamespace()},
+                Data:       map[string]string{ownership.Group: string(data)},
+            }
+            _, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+            return err
+        } else if err != nil {
+            return err
+        }
+
+        current, ok := configMap.Data[ownership.Group]
+        if ownership.Held {
+            if current == string(data) {
+                return nil
+            }
+            if configMap.Data == nil {
+                configMap.Data = make(map[string]string)
+            }
+            configMap.Data[ownership.Group] = string(data)
+        } else {
+            var holder ownershipRecord
+            if !ok || json.Unmarshal([]byte(current), &holder) != nil || holder.Node != k.node.Name {
+                return nil
+            }
+            delete(configMap.Data, ownership.Group)
+        }
+        _, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+        return err
+    })
+}
+
+// recordEvent records on this node's Node object that it took or released
+// the VIPs of the group
+func (k *K8sHealthChecker) recordEvent(ctx context.Context, ownership VIPOwnership) error {
+    reason := "VIPReleased"
+    message := fmt.Sprintf("%s released %s of group %s", k.node.Name, strings.Join(ownership.VIPs, ", "), ownership.Group)
+    if ownership.Held {
+        reason = "VIPAcquired"
+        message = fmt.Sprintf("%s holds %s of group %s (term %d)", k.node.Name, strings.Join(ownership.VIPs, ", "),
+            ownership.Group, ownership.Term)
+    }
+
+    now := metav1.NewTime(ownership.Since)
+    event := &corev1.Event{
+        ObjectMeta: metav1.ObjectMeta{GenerateName: k.node.Name + ".", Namespace: eventNamespace},
+        InvolvedObject: corev1.ObjectReference{
+            Kind:       "Node",
+            APIVersion: "v1",
+            Name:       k.node.Name,
+            UID:        types.UID(k.node.Name), // As the kubelet refers to its Node
+        },
+        Reason:              reason,
+        Message:             message,
+        Type:                corev1.EventTypeNormal,
+        Source:              corev1.EventSource{Component: "ha-vip", Host: k.node.Name},
+        FirstTimestamp:      now,
+        LastTimestamp:       now,
+        Count:               1,
+        ReportingController: "ha-vip",
+        ReportingInstance:   k.node.Name,
+    }
+    _, err := k.Client().CoreV1().Events(eventNamespace).Create(ctx, event, metav1.CreateOptions{})
+    return err
+}
+
+func (k *K8sHealthChecker) statusNamespace() string {
+    if k.cfg.K8s.StatusNamespace != "" {
+        return k.cfg.K8s.StatusNamespace
+    }
+    return defaultStatusNamespace
+}
+
+func (k *K8sHealthChecker) statusConfigMapName() string {
+    if k.cfg.K8s.StatusConfigMap != "" {
+        return k.cfg.K8s.StatusConfigMap
+    }
+    return defaultStatusConfigMap
+}
+
+func (k *K8sHealthChecker) statusConfigMapRef() string {
+    return k.statusNamespace() + "/" + k.statusConfigMapName()
+}
+
+func sameOwnership(a, b VIPOwnership) bool {
+    return a.Held == b.Held && a.Term == b.Term && a.Since.Equal(b.Since)
+}
@@ -0,0 +1,176 @@
+package k8s
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "testing"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/client-go/kubernetes/fake"
+    k8stesting "k8s.io/client-go/testing"
+
+    "github.com/2bleere/ha-vip/internal/config"
+)
+
+// newPublishChecker returns a checker for node cp-1 publishing to a fake
+// clientset that, like the API server, only accepts Events about Nodes in
+// the default namespace
+func newPublishChecker(objects ...runtime.Object) (*K8sHealthChecker, *fake.Clientset) {
+    objects = append(objects, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "cp-1"}})
+    client := fake.NewSimpleClientset(objects...)
+    generated := 0
+    client.PrependReactor("create", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+        event := action.(k8stesting.CreateAction).GetObject().(*corev1.Event)
+        if event.InvolvedObject.Kind == "Node" && event.Namespace != "default" {
+            return true, nil, fmt.Errorf("involvedObject.namespace: Invalid value: %q", event.Namespace)
+        }
+        // The fake tracker does not generate names
+        if event.Name == "" {
+            generated++
+            event.Name = event.GenerateName + fmt.Sprint(generated)
+        }
+        return false, nil, nil
+    })
+
+    cfg := &config.Config{NodeID: "cp-1"}
+    cfg.K8s.PublishStatus = true
+    return &K8sHealthChecker{cfg: cfg, client: client, node: NodeStatus{Name: "cp-1"}}, client
+}
+
+func statusEntry(t *testing.T, client *fake.Clientset, group string) (ownershipRecord, bool) {
+    t.Helper()
+    configMap, err := client.CoreV1().ConfigMaps(defaultStatusNamespace).Get(context.Background(),
+        defaultStatusConfigMap, metav1.GetOptions{})
+    if err != nil {
+        return ownershipRecord{}, false
+    }
+    data, ok := configMap.Data[group]
+    if !ok {
+        return ownershipRecord{}, false
+    }
+    var record ownershipRecord
+    if err := json.Unmarshal([]byte(data), &record); err != nil {
+        t.Fatalf("entry %s: %v", group, err)
+    }
+    return record, true
+}
+
+func TestPublish(t *testing.T) {
+    k, client := newPublishChecker()
+    ctx := context.Background()
+    held := VIPOwnership{Group: "default", VIPs: []string{"192.168.1.200/24"}, Held: true, Term: 4, Since: time.Now()}
+
+    if err := k.publish(held, nil); err != nil {
+        t.Fatalf("publish(held) = %v", err)
+    }
+    node, _ := client.CoreV1().Nodes().Get(ctx, "cp-1", metav1.GetOptions{})
+    if _, ok := node.Annotations[annotationPrefix+"default"]; !ok {
+        t.Errorf("annotations = %v, want %sdefault", node.Annotations, annotationPrefix)
+    }
+    if record, ok := statusEntry(t, client, "default"); !ok || record.Node != "cp-1" || record.Term != 4 {
+        t.Errorf("entry = %+v, %v, want cp-1 term 4", record, ok)
+    }
+    events, _ := client.CoreV1().Events(eventNamespace).List(ctx, metav1.ListOptions{})
+    if len(events.Items) != 1 || events.Items[0].Reason != "VIPAcquired" {
+        t.Fatalf("events = %+v, want one VIPAcquired", events.Items)
+    }
+
+    // Publishing the same state again records no second Event
+    if err := k.publish(held, &held); err != nil {
+        t.Fatalf("publish(held) again = %v", err)
+    }
+    events, _ = client.CoreV1().Events(eventNamespace).List(ctx, metav1.ListOptions{})
+    if len(events.Items) != 1 {
+        t.Errorf("%d events after republishing, want 1", len(events.Items))
+    }
+
+    released := held
+    released.Held = false
+    if err := k.publish(released, &held); err != nil {
+        t.Fatalf("publish(released) = %v", err)
+    }
+    node, _ = client.CoreV1().Nodes().Get(ctx, "cp-1", metav1.GetOptions{})
+    if _, ok := node.Annotations[annotationPrefix+"default"]; ok {
+        t.Errorf("annotation left after release: %v", node.Annotations)
+    }
+    if _, ok := statusEntry(t, client, "default"); ok {
+        t.Error("entry left after release")
+    }
+    events, _ = client.CoreV1().Events(eventNamespace).List(ctx, metav1.ListOptions{})
+    if len(events.Items) != 2 || events.Items[1].Reason != "VIPReleased" {
+        t.Errorf("events = %+v, want VIPAcquired and VIPReleased", events.Items)
+    }
+}
+
+func TestUpdateStatusConfigMapRelease(t *testing.T) {
+    other, _ := json.Marshal(ownershipRecord{Node: "cp-2", Term: 5})
+    own, _ := json.Marshal(ownershipRecord{Node: "cp-1", Term: 4})
+
+    tests := []struct {
+        name      string
+        entry     string // Entry of group default before the release, if any
+        wantEntry bool
+        wantNode  string
+    }{
+        {"own entry is removed", string(own), false, ""},
+        {"another holder's entry is kept", string(other), true, "cp-2"},
+        {"no entry", "", false, ""},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            configMap := &corev1.ConfigMap{
+                ObjectMeta: metav1.ObjectMeta{Name: defaultStatusConfigMap, Namespace: defaultStatusNamespace},
+                Data:       map[string]string{"other": "{}"},
+            }
+            if tt.entry != "" {
+                configMap.Data["default"] = tt.entry
+            }
+            k, client := newPublishChecker(configMap)
+
+            released := VIPOwnership{Group: "default", Term: 4}
+            if err := k.updateStatusConfigMap(context.Background(), released, ownershipRecord{Node: "cp-1", Term: 4}); err != nil {
+                t.Fatalf("updateStatusConfigMap() = %v", err)
+            }
+            record, ok := statusEntry(t, client, "default")
+            if ok != tt.wantEntry || record.Node != tt.wantNode {
+                t.Errorf("entry = %+v, %v, want node %q, %v", record, ok, tt.wantNode, tt.wantEntry)
+            }
+            if _, ok := statusEntry(t, client, "other"); !ok {
+                t.Error("entry of another group was removed")
+            }
+        })
+    }
+}
+
+func TestPublishPendingRetries(t *testing.T) {
+    k, client := newPublishChecker()
+    failing := true
+    client.PrependReactor("update", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+        if failing {
+            return true, nil, fmt.Errorf("connection refused")
+        }
+        return false, nil, nil
+    })
+    configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: defaultStatusConfigMap, Namespace: defaultStatusNamespace}}
+    client.CoreV1().ConfigMaps(defaultStatusNamespace).Create(context.Background(), configMap, metav1.CreateOptions{})
+
+    k.ownership = map[string]*ownershipState{"default": {
+        desired: VIPOwnership{Group: "default", Held: true, Term: 1, Since: time.Now()},
+        pending: true,
+    }}
+
+    k.retryPublish()
+    if state := k.ownership["default"]; !state.pending || state.lastError == "" {
+        t.Fatalf("after a failure: pending = %v, lastError = %q", state.pending, state.lastError)
+    }
+
+    failing = false
+    k.retryPublish()
+    if state := k.ownership["default"]; state.pending || state.lastError != "" || state.published == nil {
+        t.Errorf("after a retry: pending = %v, lastError = %q, published = %v", state.pending, state.lastError, state.published)
+    }
+}
@@ -0,0 +1,128 @@
+// Package maintenance keeps a node out of leader elections while it is
+// being worked on. The state lives in a marker file, so it survives
+// restarts and can also be toggled by creating or removing the file.
+package maintenance
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/2bleere/ha-vip/internal/heartbeat"
+)
+
+// DefaultFile is the marker file used when maintenance_file is not set
+const DefaultFile = "/var/lib/ha-vip/maintenance"
+
+// pollInterval is how often the marker file is checked for changes made
+// outside the daemon
+const pollInterval = 2 * time.Second
+
+// Status describes the maintenance mode of the local node
+type Status struct {
+    Enabled bool      `json:"enabled"`
+    Reason  string    `json:"reason,omitempty"`
+    Since   time.Time `json:"since,omitempty"`
+    File    string    `json:"file"`
+}
+
+// Manager applies the maintenance marker file to the heartbeat, which
+// advertises it to peers and elections
+type Manager struct {
+    path   string
+    hb     *heartbeat.Heartbeat
+    mu     sync.Mutex
+    status Status
+    stopCh chan struct{}
+}
+
+func NewManager(path string, hb *heartbeat.Heartbeat) *Manager {
+    if path == "" {
+        path = DefaultFile
+    }
+    m := &Manager{
+        path:   path,
+        hb:     hb,
+        stopCh: make(chan struct{}),
+    }
+    m.reload()
+    return m
+}
+
+// Start watches the marker file until Stop is called
+func (m *Manager) Start() {
+    ticker := time.NewTicker(pollInterval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ticker.C:
+            m.reload()
+        case <-m.stopCh:
+            return
+        }
+    }
+}
+
+func (m *Manager) Stop() {
+    close(m.stopCh)
+}
+
+// Set enters or leaves maintenance mode and records it in the marker file
+func (m *Manager) Set(enabled bool, reason string) error {
+    if enabled {
+        if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+            return fmt.Errorf("failed to create %s: %w", filepath.Dir(m.path), err)
+        }
+        if err := os.WriteFile(m.path, []byte(reason+"\n"), 0644); err != nil {
+            return fmt.Errorf("failed to write maintenance file: %w", err)
+        }
+    } else if err := os.Remove(m.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+        return fmt.Errorf("failed to remove maintenance file: %w", err)
+    }
+    m.reload()
+    return nil
+}
+
+// Status returns the current maintenance mode
+func (m *Manager) Status() Status {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.status
+}
+
+// reload reads the marker file and applies any change
+func (m *Manager) reload() {
+    status := Status{File: m.path}
+    info, err := os.Stat(m.path)
+    if err == nil {
+        status.Enabled = true
+        status.Since = info.ModTime()
+        if data, err := os.ReadFile(m.path); err == nil {
+            status.Reason = strings.TrimSpace(string(data))
+        }
+    } else if !errors.Is(err, os.ErrNotExist) {
+        log.Printf("Maintenance: Failed to check %s: %v", m.path, err)
+        return
+    }
+
+    m.mu.Lock()
+    changed := m.status.Enabled != status.Enabled || m.status.File == ""
+    m.status = status
+    m.mu.Unlock()
+
+    if !changed {
+        return
+    }
+    if status.Enabled {
+        log.Printf("Maintenance: Node is in maintenance mode (reason: %q), it will not be elected leader", status.Reason)
+    } else if m.hb.InMaintenance() {
+        log.Printf("Maintenance: Node left maintenance mode")
+    }
+    m.hb.SetMaintenance(status.Enabled)
+}
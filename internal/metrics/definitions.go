@@ -0,0 +1,67 @@
+package metrics
+
+// Election
+var (
+    IsLeader = NewGaugeVec("is_leader",
+        "Whether this node is the leader of the VIP group (1) or not (0).", "group")
+    Leader = NewGaugeVec("leader",
+        "Current leader of the VIP group; the sample for the leader is 1.", "group", "leader")
+    LeadershipTransitions = NewCounterVec("leadership_transitions_total",
+        "Number of times the leader of the VIP group changed.", "group")
+    ElectionTerm = NewGaugeVec("election_term",
+        "Election term of the VIP group as seen by this node.", "group")
+    EffectivePriority = NewGaugeVec("effective_priority",
+        "This node's priority for the VIP group after health check weights; lower wins.", "group")
+    LeaseAvailable = NewGaugeVec("lease_available",
+        "Whether the VIP group's Kubernetes Lease decides the leader (1) or the heartbeat election stands in (0).", "group")
+)
+
+// VIP
+var (
+    VIPAssigned = NewGaugeVec("vip_assigned",
+        "Whether the VIP is configured on this node (1) or not (0).", "group", "vip")
+    GARPSent = NewCounterVec("garp_sent_total",
+        "Gratuitous ARP and unsolicited neighbor advertisement bursts by method and result.", "method", "result")
+)
+
+// Heartbeat
+var (
+    HeartbeatsSent = NewCounterVec("heartbeats_sent_total",
+        "Heartbeats sent to peers by result.", "result")
+    HeartbeatsReceived = NewCounterVec("heartbeats_received_total",
+        "Heartbeats received and accepted from peers.")
+    HeartbeatErrors = NewCounterVec("heartbeat_errors_total",
+        "Heartbeat errors by kind (send, receive, parse, rejected).", "kind")
+)
+
+// Kubernetes
+var (
+    K8sReadyzChecks = NewCounterVec("k8s_readyz_checks_total",
+        "Kubernetes API server /readyz checks by result (ok, degraded, not_ready, error).", "result")
+    K8sReadyzDuration = NewGaugeVec("k8s_readyz_duration_seconds",
+        "Latency of the most recent /readyz check.")
+    K8sLivezChecks = NewCounterVec("k8s_livez_checks_total",
+        "Kubernetes API server /livez checks by result (ok, degraded, not_ready, error).", "result")
+    K8sLivezDuration = NewGaugeVec("k8s_livez_duration_seconds",
+        "Latency of the most recent /livez check.")
+    K8sAPIServerCheck = NewGaugeVec("k8s_apiserver_check_healthy",
+        "Whether an individual /readyz or /livez check of the API server passed (1) or not (0).", "endpoint", "check")
+    K8sNodeHealthy = NewGaugeVec("k8s_node_healthy",
+        "Whether this node's Node object is Ready, without pressure, uncordoned and free of unhealthy taints.")
+    K8sHealthy = NewGaugeVec("k8s_healthy",
+        "Stable Kubernetes API server health used for elections.")
+)
+
+// Health checks
+var (
+    HealthChecks = NewCounterVec("health_checks_total",
+        "Local health check runs by check and result.", "check", "result")
+    HealthCheckHealthy = NewGaugeVec("health_check_healthy",
+        "Whether the local health check is healthy (1) or not (0) after rise/fall.", "check")
+)
+
+// Result label values
+const (
+    ResultSuccess = "success"
+    ResultFailure = "failure"
+)
@@ -0,0 +1,266 @@
+// Package metrics exposes ha-vip's state in the Prometheus text format.
+//
+// Metrics are package-level so that the election, heartbeat, k8s and vip
+// packages can record them without threading a registry through every
+// constructor.
+package metrics
+
+import (
+    "bytes"
+    "fmt"
+    "log"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+const namespace = "ha_vip"
+
+var registry = struct {
+    mu      sync.Mutex
+    metrics map[string]collector
+}{metrics: make(map[string]collector)}
+
+// collector writes one metric family in the text exposition format
+type collector interface {
+    name() string
+    write(buf *bytes.Buffer)
+}
+
+func register(c collector) {
+    registry.mu.Lock()
+    defer registry.mu.Unlock()
+    registry.metrics[c.name()] = c
+}
+
+// vec holds the samples of a metric family keyed by their label values.
+type vec struct {
+    fullName string
+    help     string
+    kind     string
+    labels   []string
+    mu       sync.Mutex
+    samples  map[string]*sample
+}
+
+type sample struct {
+    labelValues []string
+    value       float64
+}
+
+func newVec(name, help, kind string, labels []string) *vec {
+    v := &vec{
+        fullName: namespace + "_" + name,
+        help:     help,
+        kind:     kind,
+        labels:   labels,
+        samples:  make(map[string]*sample),
+    }
+    if kind == "counter" && len(labels) == 0 {
+        // Report unlabelled counters as 0 before the first increment;
+        // gauges stay absent until they are first set
+        v.get(nil)
+    }
+    register(v)
+    return v
+}
+
+func (v *vec) name() string {
+    return v.fullName
+}
+
+func (v *vec) get(labelValues []string) *sample {
+    if len(labelValues) != len(v.labels) {
+        panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.fullName, len(v.labels), len(labelValues)))
+    }
+    key := strings.Join(labelValues, "\xff")
+    s, ok := v.samples[key]
+    if !ok {
+        s = &sample{labelValues: append([]string(nil), labelValues...)}
+        v.samples[key] = s
+    }
+    return s
+}
+
+func (v *vec) write(buf *bytes.Buffer) {
+    v.mu.Lock()
+    samples := make([]sample, 0, len(v.samples))
+    for _, s := range v.samples {
+        samples = append(samples, *s)
+    }
+    v.mu.Unlock()
+
+    writeFamily(buf, v.fullName, v.help, v.kind, v.labels, samples)
+}
+
+// GaugeVec is a gauge partitioned by labels.
+type GaugeVec struct {
+    *vec
+}
+
+// NewGaugeVec registers a gauge named ha_vip_<name>.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+    return &GaugeVec{newVec(name, help, "gauge", labels)}
+}
+
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    g.get(labelValues).value = value
+}
+
+// SetBool sets the gauge to 1 when b is true and 0 otherwise.
+func (g *GaugeVec) SetBool(b bool, labelValues ...string) {
+    value := 0.0
+    if b {
+        value = 1
+    }
+    g.Set(value, labelValues...)
+}
+
+// Delete removes the sample with the given label values.
+func (g *GaugeVec) Delete(labelValues ...string) {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    delete(g.samples, strings.Join(labelValues, "\xff"))
+}
+
+// CounterVec is a monotonically increasing counter partitioned by labels.
+type CounterVec struct {
+    *vec
+}
+
+// NewCounterVec registers a counter named ha_vip_<name>.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+    return &CounterVec{newVec(name, help, "counter", labels)}
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+    c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+    if delta < 0 {
+        return
+    }
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.get(labelValues).value += delta
+}
+
+// Sample is a single value reported by a GaugeFunc.
+type Sample struct {
+    LabelValues []string
+    Value       float64
+}
+
+// gaugeFunc computes its samples when scraped.
+type gaugeFunc struct {
+    fullName string
+    help     string
+    labels   []string
+    collect  func() []Sample
+}
+
+// NewGaugeFunc registers a gauge named ha_vip_<name> whose samples are
+// computed by collect on every scrape. Registering the same name again
+// replaces the previous function.
+func NewGaugeFunc(name, help string, labels []string, collect func() []Sample) {
+    register(&gaugeFunc{
+        fullName: namespace + "_" + name,
+        help:     help,
+        labels:   labels,
+        collect:  collect,
+    })
+}
+
+func (g *gaugeFunc) name() string {
+    return g.fullName
+}
+
+func (g *gaugeFunc) write(buf *bytes.Buffer) {
+    var samples []sample
+    for _, s := range g.collect() {
+        if len(s.LabelValues) != len(g.labels) {
+            continue
+        }
+        samples = append(samples, sample{labelValues: s.LabelValues, value: s.Value})
+    }
+    writeFamily(buf, g.fullName, g.help, "gauge", g.labels, samples)
+}
+
+func writeFamily(buf *bytes.Buffer, name, help, kind string, labels []string, samples []sample) {
+    sort.Slice(samples, func(i, j int) bool {
+        return strings.Join(samples[i].labelValues, "\xff") < strings.Join(samples[j].labelValues, "\xff")
+    })
+
+    fmt.Fprintf(buf, "# HELP %s %s\n", name, escapeHelp(help))
+    fmt.Fprintf(buf, "# TYPE %s %s\n", name, kind)
+    for _, s := range samples {
+        buf.WriteString(name)
+        if len(labels) > 0 {
+            buf.WriteByte('{')
+            for i, label := range labels {
+                if i > 0 {
+                    buf.WriteByte(',')
+                }
+                fmt.Fprintf(buf, "%s=\"%s\"", label, escapeLabel(s.labelValues[i]))
+            }
+            buf.WriteByte('}')
+        }
+        buf.WriteByte(' ')
+        buf.WriteString(strconv.FormatFloat(s.value, 'g', -1, 64))
+        buf.WriteByte('\n')
+    }
+}
+
+// escapeHelp escapes a docstring as the text format requires: like a label
+// value, but with quotes left alone
+func escapeHelp(help string) string {
+    help = strings.ReplaceAll(help, `\`, `\\`)
+    return strings.ReplaceAll(help, "\n", `\n`)
+}
+
+func escapeLabel(value string) string {
+    value = strings.ReplaceAll(value, `\`, `\\`)
+    value = strings.ReplaceAll(value, `"`, `\"`)
+    return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+// Handler serves all registered metrics in the Prometheus text format.
+func Handler() http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        registry.mu.Lock()
+        names := make([]string, 0, len(registry.metrics))
+        for name := range registry.metrics {
+            names = append(names, name)
+        }
+        collectors := make([]collector, 0, len(names))
+        sort.Strings(names)
+        for _, name := range names {
+            collectors = append(collectors, registry.metrics[name])
+        }
+        registry.mu.Unlock()
+
+        var buf bytes.Buffer
+        for _, c := range collectors {
+            c.write(&buf)
+        }
+
+        w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+        w.Write(buf.Bytes())
+    })
+}
+
+// Serve exposes /metrics on addr. It blocks, so run it in a goroutine.
+func Serve(addr string) {
+    mux := http.NewServeMux()
+    mux.Handle("/metrics", Handler())
+
+    log.Printf("Metrics: Serving Prometheus metrics on %s/metrics", addr)
+    if err := http.ListenAndServe(addr, mux); err != nil {
+        log.Printf("Metrics: HTTP server stopped: %v", err)
+    }
+}
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+    "bytes"
+    "math"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestWriteFamily(t *testing.T) {
+    tests := []struct {
+        name    string
+        help    string
+        labels  []string
+        samples []sample
+        want    string
+    }{
+        {
+            name:    "unlabelled",
+            help:    "Whether this node leads.",
+            samples: []sample{{value: 1}},
+            want: "# HELP ha_vip_test Whether this node leads.\n" +
+                "# TYPE ha_vip_test gauge\n" +
+                "ha_vip_test 1\n",
+        },
+        {
+            name:   "sorted by label values",
+            help:   "Peers.",
+            labels: []string{"group", "peer"},
+            samples: []sample{
+                {labelValues: []string{"default", "node3"}, value: 3},
+                {labelValues: []string{"api", "node2"}, value: 0.5},
+                {labelValues: []string{"default", "node1"}, value: 1},
+            },
+            want: "# HELP ha_vip_test Peers.\n" +
+                "# TYPE ha_vip_test gauge\n" +
+                "ha_vip_test{group=\"api\",peer=\"node2\"} 0.5\n" +
+                "ha_vip_test{group=\"default\",peer=\"node1\"} 1\n" +
+                "ha_vip_test{group=\"default\",peer=\"node3\"} 3\n",
+        },
+        {
+            name:    "escaped label values",
+            help:    "Checks.",
+            labels:  []string{"check"},
+            samples: []sample{{labelValues: []string{"a\"b\\c\nd"}, value: 0}},
+            want: "# HELP ha_vip_test Checks.\n" +
+                "# TYPE ha_vip_test gauge\n" +
+                "ha_vip_test{check=\"a\\\"b\\\\c\\nd\"} 0\n",
+        },
+        {
+            name:    "escaped help",
+            help:    "Line one\nC:\\path \"quoted\"",
+            samples: []sample{{value: 2}},
+            want: "# HELP ha_vip_test Line one\\nC:\\\\path \"quoted\"\n" +
+                "# TYPE ha_vip_test gauge\n" +
+                "ha_vip_test 2\n",
+        },
+        {
+            name:   "special values",
+            help:   "Values.",
+            labels: []string{"v"},
+            samples: []sample{
+                {labelValues: []string{"a"}, value: math.Inf(1)},
+                {labelValues: []string{"b"}, value: math.Inf(-1)},
+                {labelValues: []string{"c"}, value: math.NaN()},
+                {labelValues: []string{"d"}, value: 1e21},
+            },
+            want: "# HELP ha_vip_test Values.\n" +
+                "# TYPE ha_vip_test gauge\n" +
+                "ha_vip_test{v=\"a\"} +Inf\n" +
+                "ha_vip_test{v=\"b\"} -Inf\n" +
+                "ha_vip_test{v=\"c\"} NaN\n" +
+                "ha_vip_test{v=\"d\"} 1e+21\n",
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var buf bytes.Buffer
+            writeFamily(&buf, "ha_vip_test", tt.help, "gauge", tt.labels, tt.samples)
+            if got := buf.String(); got != tt.want {
+                t.Errorf("writeFamily() =\n%s\nwant\n%s", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestHandler(t *testing.T) {
+    gauge := NewGaugeVec("test_zz_gauge", "A test gauge.", "peer")
+    gauge.Set(2, "node2")
+    gauge.Set(1, "node1")
+    counter := NewCounterVec("test_aa_total", "A test counter.")
+    counter.Add(3)
+    counter.Add(-1) // Ignored, counters never go down
+    NewGaugeFunc("test_mm_func", "A test gauge func.", []string{"peer"}, func() []Sample {
+        return []Sample{{LabelValues: []string{"node1"}, Value: 7}, {LabelValues: []string{"bad", "labels"}, Value: 8}}
+    })
+
+    render := func() string {
+        rec := httptest.NewRecorder()
+        Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+        if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+            t.Errorf("Content-Type = %q", ct)
+        }
+        return rec.Body.String()
+    }
+    body := render()
+
+    for _, want := range []string{
+        "# TYPE ha_vip_test_aa_total counter\nha_vip_test_aa_total 3\n",
+        "# TYPE ha_vip_test_mm_func gauge\nha_vip_test_mm_func{peer=\"node1\"} 7\n",
+        "# TYPE ha_vip_test_zz_gauge gauge\nha_vip_test_zz_gauge{peer=\"node1\"} 1\nha_vip_test_zz_gauge{peer=\"node2\"} 2\n",
+    } {
+        if !strings.Contains(body, want) {
+            t.Errorf("output lacks\n%s", want)
+        }
+    }
+    if strings.Contains(body, "bad") {
+        t.Error("sample with the wrong number of labels was written")
+    }
+
+    // Families appear sorted by name, the same way on every scrape
+    aa := strings.Index(body, "# HELP ha_vip_test_aa_total")
+    mm := strings.Index(body, "# HELP ha_vip_test_mm_func")
+    zz := strings.Index(body, "# HELP ha_vip_test_zz_gauge")
+    if !(aa < mm && mm < zz) {
+        t.Errorf("families out of order: aa at %d, mm at %d, zz at %d", aa, mm, zz)
+    }
+    if again := render(); again != body {
+        t.Error("output differs between scrapes")
+    }
+
+    gauge.Delete("node2")
+    if strings.Contains(render(), "peer=\"node2\"") {
+        t.Error("deleted sample still written")
+    }
+}
@@ -0,0 +1,233 @@
+package vip
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "net"
+    "os/exec"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Supported values for config.VIPBackend
+const (
+    BackendAuto    = "auto"
+    BackendNetlink = "netlink"
+    BackendExec    = "exec"
+)
+
+// AddressOptions controls how the VIP is configured on the interface.
+type AddressOptions struct {
+    // Label is the address label (IPv4 only), e.g. "eth0:vip"
+    Label string
+    // PreferredLifetime in seconds; negative means forever. A preferred
+    // lifetime of 0 keeps the VIP from being picked as a source address.
+    PreferredLifetime int
+    // NoDAD skips duplicate address detection for IPv6 VIPs
+    NoDAD bool
+}
+
+// AddressManager adds and removes addresses on a network interface.
+// Adding an address that is already present and deleting one that is
+// already gone both succeed. For IPv6 addresses added without NoDAD,
+// AddAddress waits for duplicate address detection to finish and fails
+// (removing the address again) if another host already uses it.
+type AddressManager interface {
+    Name() string
+    AddAddress(iface string, addr *net.IPNet, opts AddressOptions) error
+    DeleteAddress(iface string, addr *net.IPNet) error
+}
+
+// newAddressManager returns the address backend selected in config. The
+// "auto" backend prefers netlink and falls back to the ip command.
+func newAddressManager(backend string) (AddressManager, error) {
+    switch backend {
+    case "", BackendAuto:
+        nl, err := newNetlinkManager()
+        if err != nil {
+            log.Printf("VIP Manager: netlink unavailable (%v), using ip command", err)
+            return &execManager{}, nil
+        }
+        return &fallbackManager{primary: nl, fallback: &execManager{}}, nil
+    case BackendNetlink:
+        return newNetlinkManager()
+    case BackendExec:
+        return &execManager{}, nil
+    default:
+        return nil, fmt.Errorf("unknown VIP backend %q (expected %q, %q or %q)", backend, BackendAuto, BackendNetlink, BackendExec)
+    }
+}
+
+// parseVIP parses a VIP with or without CIDR notation. Addresses without a
+// prefix length are treated as host addresses (/32 or /128).
+func parseVIP(vip string) (*net.IPNet, error) {
+    if strings.Contains(vip, "/") {
+        ip, network, err := net.ParseCIDR(vip)
+        if err != nil {
+            return nil, fmt.Errorf("invalid VIP %q: %w", vip, err)
+        }
+        return &net.IPNet{IP: ip, Mask: network.Mask}, nil
+    }
+
+    ip := net.ParseIP(vip)
+    if ip == nil {
+        return nil, fmt.Errorf("invalid VIP %q", vip)
+    }
+    if ip4 := ip.To4(); ip4 != nil {
+        return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+    }
+    return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// ErrDuplicateAddress is returned by AddAddress when IPv6 duplicate address
+// detection finds the VIP already in use on the link
+var ErrDuplicateAddress = errors.New("duplicate address detected")
+
+// dadTimeout bounds how long AddAddress waits for IPv6 duplicate address
+// detection to complete
+var dadTimeout = 5 * time.Second
+
+// waitForDAD polls state until addr is no longer tentative.
+func waitForDAD(addr *net.IPNet, state func() (tentative, failed bool, err error)) error {
+    deadline := time.Now().Add(dadTimeout)
+    for {
+        tentative, failed, err := state()
+        if err != nil {
+            return err
+        }
+        if failed {
+            return fmt.Errorf("%w: %s is in use by another host", ErrDuplicateAddress, addr.IP)
+        }
+        if !tentative {
+            return nil
+        }
+        if time.Now().After(deadline) {
+            return fmt.Errorf("timed out waiting for duplicate address detection on %s", addr.IP)
+        }
+        time.Sleep(100 * time.Millisecond)
+    }
+}
+
+// needsDAD reports whether adding addr triggers duplicate address detection
+func needsDAD(addr *net.IPNet, opts AddressOptions) bool {
+    return addr.IP.To4() == nil && !opts.NoDAD
+}
+
+// maxLabelLength is the longest address label Linux accepts (IFNAMSIZ
+// without the terminating NUL)
+const maxLabelLength = 15
+
+// addressLabel returns a label the kernel accepts for iface. Linux requires
+// IPv4 labels to start with the interface name and to fit in IFNAMSIZ.
+func addressLabel(iface, label string) string {
+    if label != "" && !strings.HasPrefix(label, iface) {
+        label = iface + ":" + label
+    }
+    if len(label) > maxLabelLength {
+        label = label[:maxLabelLength]
+    }
+    return label
+}
+
+// execManager manages addresses by running the ip command from iproute2.
+type execManager struct{}
+
+func (m *execManager) Name() string {
+    return "ip command"
+}
+
+func (m *execManager) AddAddress(iface string, addr *net.IPNet, opts AddressOptions) error {
+    args := []string{"addr", "add", addr.String(), "dev", iface}
+    if opts.Label != "" && addr.IP.To4() != nil {
+        args = append(args, "label", addressLabel(iface, opts.Label))
+    }
+    if opts.PreferredLifetime >= 0 {
+        args = append(args, "valid_lft", "forever", "preferred_lft", strconv.Itoa(opts.PreferredLifetime))
+    }
+    if opts.NoDAD && addr.IP.To4() == nil {
+        args = append(args, "nodad")
+    }
+
+    output, err := exec.Command("ip", args...).CombinedOutput()
+    if err != nil {
+        if strings.Contains(string(output), "File exists") {
+            return nil
+        }
+        return fmt.Errorf("ip %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+    }
+    
+    if needsDAD(addr, opts) {
+        if err := waitForDAD(addr, func() (bool, bool, error) { return m.dadState(iface, addr) }); err != nil {
+            m.DeleteAddress(iface, addr)
+            return err
+        }
+    }
+    return nil
+}
+
+// dadState reads the tentative and dadfailed flags of addr from ip's output
+func (m *execManager) dadState(iface string, addr *net.IPNet) (bool, bool, error) {
+    output, err := exec.Command("ip", "-6", "-o", "addr", "show", "dev", iface).CombinedOutput()
+    if err != nil {
+        return false, false, fmt.Errorf("ip -6 addr show dev %s: %v: %s", iface, err, strings.TrimSpace(string(output)))
+    }
+    
+    for _, line := range strings.Split(string(output), "\n") {
+        fields := strings.Fields(line)
+        for i, field := range fields {
+            if field == "inet6" && i+1 < len(fields) && strings.HasPrefix(fields[i+1], addr.IP.String()+"/") {
+                return strings.Contains(line, "tentative"), strings.Contains(line, "dadfailed"), nil
+            }
+        }
+    }
+    return false, false, fmt.Errorf("address %s not found on %s", addr.IP, iface)
+}
+
+func (m *execManager) DeleteAddress(iface string, addr *net.IPNet) error {
+    args := []string{"addr", "del", addr.String(), "dev", iface}
+    output, err := exec.Command("ip", args...).CombinedOutput()
+    if err != nil {
+        if strings.Contains(string(output), "Cannot assign requested address") {
+            return nil
+        }
+        return fmt.Errorf("ip %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+    }
+    return nil
+}
+
+// fallbackManager tries the primary backend first and retries with the
+// fallback backend when it fails.
+type fallbackManager struct {
+    primary  AddressManager
+    fallback AddressManager
+}
+
+func (m *fallbackManager) Name() string {
+    return m.primary.Name() + " (fallback: " + m.fallback.Name() + ")"
+}
+
+func (m *fallbackManager) AddAddress(iface string, addr *net.IPNet, opts AddressOptions) error {
+    err := m.primary.AddAddress(iface, addr, opts)
+    if err == nil || errors.Is(err, ErrDuplicateAddress) {
+        return err
+    }
+    log.Printf("VIP Manager: %s failed to add %s (%v), retrying with %s", m.primary.Name(), addr, err, m.fallback.Name())
+    if fallbackErr := m.fallback.AddAddress(iface, addr, opts); fallbackErr != nil {
+        return fmt.Errorf("%s: %v; %s: %w", m.primary.Name(), err, m.fallback.Name(), fallbackErr)
+    }
+    return nil
+}
+
+func (m *fallbackManager) DeleteAddress(iface string, addr *net.IPNet) error {
+    err := m.primary.DeleteAddress(iface, addr)
+    if err == nil {
+        return nil
+    }
+    log.Printf("VIP Manager: %s failed to delete %s (%v), retrying with %s", m.primary.Name(), addr, err, m.fallback.Name())
+    if fallbackErr := m.fallback.DeleteAddress(iface, addr); fallbackErr != nil {
+        return fmt.Errorf("%s: %v; %s: %w", m.primary.Name(), err, m.fallback.Name(), fallbackErr)
+    }
+    return nil
+}
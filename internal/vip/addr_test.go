@@ -0,0 +1,151 @@
+package vip
+
+import (
+    "errors"
+    "net"
+    "testing"
+)
+
+func TestParseVIP(t *testing.T) {
+    tests := []struct {
+        vip     string
+        want    string
+        wantErr bool
+    }{
+        {"192.168.1.200", "192.168.1.200/32", false},
+        {"192.168.1.200/24", "192.168.1.200/24", false},
+        {"2001:db8::10", "2001:db8::10/128", false},
+        {"2001:db8::10/64", "2001:db8::10/64", false},
+        {"::ffff:10.0.0.1", "10.0.0.1/32", false},
+        {"192.168.1.300", "", true},
+        {"192.168.1.200/33", "", true},
+        {"2001:db8::10/129", "", true},
+        {"vip.example.com", "", true},
+        {"", "", true},
+    }
+    for _, tt := range tests {
+        got, err := parseVIP(tt.vip)
+        if (err != nil) != tt.wantErr {
+            t.Errorf("parseVIP(%q) error = %v, wantErr %v", tt.vip, err, tt.wantErr)
+            continue
+        }
+        if err == nil && got.String() != tt.want {
+            t.Errorf("parseVIP(%q) = %s, want %s", tt.vip, got, tt.want)
+        }
+    }
+}
+
+func TestParseVIPKeepsHostBits(t *testing.T) {
+    // The address itself is added, not the network it belongs to
+    got, err := parseVIP("10.0.0.5/8")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !got.IP.Equal(net.ParseIP("10.0.0.5")) {
+        t.Errorf("parseVIP() IP = %v, want 10.0.0.5", got.IP)
+    }
+    if ones, bits := got.Mask.Size(); ones != 8 || bits != 32 {
+        t.Errorf("parseVIP() mask = /%d of %d bits, want /8 of 32", ones, bits)
+    }
+}
+
+func TestAddressLabel(t *testing.T) {
+    tests := []struct {
+        iface string
+        label string
+        want  string
+    }{
+        {"eth0", "", ""},
+        {"eth0", "vip", "eth0:vip"},
+        {"eth0", "eth0:vip", "eth0:vip"},
+        {"eth0", "eth0", "eth0"},
+        {"eth0", "haproxy-vip", "eth0:haproxy-vi"},
+        {"enp0s31f6", "vip", "enp0s31f6:vip"},
+        {"enp0s31f6", "apiserver", "enp0s31f6:apise"},
+        {"enp0s31f6", "enp0s31f6:apiserver", "enp0s31f6:apise"},
+    }
+    for _, tt := range tests {
+        got := addressLabel(tt.iface, tt.label)
+        if got != tt.want {
+            t.Errorf("addressLabel(%q, %q) = %q, want %q", tt.iface, tt.label, got, tt.want)
+        }
+        if len(got) > maxLabelLength {
+            t.Errorf("addressLabel(%q, %q) is %d bytes long", tt.iface, tt.label, len(got))
+        }
+    }
+}
+
+// fakeManager records calls and fails with err
+type fakeManager struct {
+    name    string
+    err     error
+    added   []string
+    deleted []string
+}
+
+func (m *fakeManager) Name() string { return m.name }
+
+func (m *fakeManager) AddAddress(iface string, addr *net.IPNet, opts AddressOptions) error {
+    m.added = append(m.added, addr.String())
+    return m.err
+}
+
+func (m *fakeManager) DeleteAddress(iface string, addr *net.IPNet) error {
+    m.deleted = append(m.deleted, addr.String())
+    return m.err
+}
+
+func TestFallbackManager(t *testing.T) {
+    failed := errors.New("operation not supported")
+    duplicate := ErrDuplicateAddress
+
+    tests := []struct {
+        name         string
+        primaryErr   error
+        fallbackErr  error
+        wantFallback bool // Whether the fallback is used to add the address
+        wantErr      bool
+        wantIs       error
+    }{
+        {"primary succeeds", nil, nil, false, false, nil},
+        {"primary fails", failed, nil, true, false, nil},
+        {"both fail", failed, errors.New("ip: not found"), true, true, nil},
+        {"duplicate address is final", duplicate, nil, false, true, ErrDuplicateAddress},
+        {"duplicate address from fallback", failed, duplicate, true, true, ErrDuplicateAddress},
+    }
+    addr, _ := parseVIP("2001:db8::10/64")
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            primary := &fakeManager{name: "netlink", err: tt.primaryErr}
+            fallback := &fakeManager{name: "ip command", err: tt.fallbackErr}
+            m := &fallbackManager{primary: primary, fallback: fallback}
+
+            err := m.AddAddress("eth0", addr, AddressOptions{})
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("AddAddress() error = %v, wantErr %v", err, tt.wantErr)
+            }
+            if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+                t.Errorf("AddAddress() error = %v, want %v", err, tt.wantIs)
+            }
+            if len(primary.added) != 1 {
+                t.Errorf("primary added %v, want one call", primary.added)
+            }
+            if used := len(fallback.added) > 0; used != tt.wantFallback {
+                t.Errorf("fallback used = %v, want %v", used, tt.wantFallback)
+            }
+
+            err = m.DeleteAddress("eth0", addr)
+            if wantErr := tt.primaryErr != nil && tt.fallbackErr != nil; (err != nil) != wantErr {
+                t.Errorf("DeleteAddress() error = %v, wantErr %v", err, wantErr)
+            }
+            if used := len(fallback.deleted) > 0; used != (tt.primaryErr != nil) {
+                t.Errorf("fallback used for delete = %v, want %v", used, tt.primaryErr != nil)
+            }
+        })
+    }
+
+    m := &fallbackManager{primary: &fakeManager{name: "netlink"}, fallback: &fakeManager{name: "ip command"}}
+    if got, want := m.Name(), "netlink (fallback: ip command)"; got != want {
+        t.Errorf("Name() = %q, want %q", got, want)
+    }
+}
@@ -0,0 +1,104 @@
+package vip
+
+import (
+    "encoding/binary"
+    "fmt"
+    "net"
+    "time"
+
+    "golang.org/x/sys/unix"
+)
+
+const (
+    etherTypeARP  = 0x0806
+    etherTypeIPv4 = 0x0800
+    arpRequest    = 1
+    arpReply      = 2
+)
+
+var broadcastMAC = net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+// sendNativeGARP announces ip on iface by writing gratuitous ARP request and
+// reply frames to an AF_PACKET socket. It needs CAP_NET_RAW, not root.
+func sendNativeGARP(ifaceName string, ip net.IP, count int, interval time.Duration) error {
+    ip4 := ip.To4()
+    if ip4 == nil {
+        return fmt.Errorf("%s is not an IPv4 address", ip)
+    }
+
+    iface, err := net.InterfaceByName(ifaceName)
+    if err != nil {
+        return fmt.Errorf("interface %s: %w", ifaceName, err)
+    }
+    if len(iface.HardwareAddr) != 6 {
+        return fmt.Errorf("interface %s has no Ethernet address", ifaceName)
+    }
+
+    fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW|unix.SOCK_CLOEXEC, int(htons(etherTypeARP)))
+    if err != nil {
+        return fmt.Errorf("failed to open packet socket (CAP_NET_RAW required): %w", err)
+    }
+    defer unix.Close(fd)
+
+    addr := &unix.SockaddrLinklayer{
+        Protocol: htons(etherTypeARP),
+        Ifindex:  iface.Index,
+        Halen:    6,
+    }
+    copy(addr.Addr[:], broadcastMAC)
+
+    // RFC 5227 announcement (request with zero target hardware address)
+    // plus a broadcast reply, which some switches only learn from
+    frames := [][]byte{
+        garpFrame(iface.HardwareAddr, ip4, arpRequest, net.HardwareAddr{0, 0, 0, 0, 0, 0}),
+        garpFrame(iface.HardwareAddr, ip4, arpReply, broadcastMAC),
+    }
+
+    if count < 1 {
+        count = 1
+    }
+    for i := 0; i < count; i++ {
+        if i > 0 {
+            time.Sleep(interval)
+        }
+        for _, frame := range frames {
+            if err := unix.Sendto(fd, frame, 0, addr); err != nil {
+                return fmt.Errorf("failed to send gratuitous ARP on %s: %w", ifaceName, err)
+            }
+        }
+    }
+
+    return nil
+}
+
+// garpFrame builds an Ethernet frame carrying an ARP packet in which the
+// sender and target protocol addresses are both the announced IP.
+func garpFrame(mac net.HardwareAddr, ip net.IP, op uint16, targetMAC net.HardwareAddr) []byte {
+    frame := make([]byte, 14+28)
+
+    // Ethernet header
+    copy(frame[0:6], broadcastMAC)
+    copy(frame[6:12], mac)
+    binary.BigEndian.PutUint16(frame[12:14], etherTypeARP)
+
+    // ARP payload
+    arp := frame[14:]
+    binary.BigEndian.PutUint16(arp[0:2], 1) // Ethernet
+    binary.BigEndian.PutUint16(arp[2:4], etherTypeIPv4)
+    arp[4] = 6
+    arp[5] = 4
+    binary.BigEndian.PutUint16(arp[6:8], op)
+    copy(arp[8:14], mac)
+    copy(arp[14:18], ip)
+    copy(arp[18:24], targetMAC)
+    copy(arp[24:28], ip)
+
+    return frame
+}
+
+// htons converts v to network byte order as expected by AF_PACKET
+func htons(v uint16) uint16 {
+    b := make([]byte, 2)
+    binary.BigEndian.PutUint16(b, v)
+    return binary.NativeEndian.Uint16(b)
+}
@@ -0,0 +1,50 @@
+package vip
+
+import (
+    "bytes"
+    "net"
+    "testing"
+)
+
+func TestGarpFrame(t *testing.T) {
+    mac := net.HardwareAddr{0x52, 0x54, 0x00, 0x12, 0x34, 0x56}
+    ip := net.ParseIP("192.168.1.200").To4()
+
+    tests := []struct {
+        name      string
+        op        uint16
+        targetMAC net.HardwareAddr
+        want      []byte
+    }{
+        {"request", arpRequest, net.HardwareAddr{0, 0, 0, 0, 0, 0}, []byte{
+            0xff, 0xff, 0xff, 0xff, 0xff, 0xff, // Broadcast destination
+            0x52, 0x54, 0x00, 0x12, 0x34, 0x56, // Source
+            0x08, 0x06, // ARP
+            0x00, 0x01, 0x08, 0x00, 6, 4, // Ethernet, IPv4, address lengths
+            0x00, 0x01, // Request
+            0x52, 0x54, 0x00, 0x12, 0x34, 0x56, 192, 168, 1, 200, // Sender
+            0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 192, 168, 1, 200, // Target
+        }},
+        {"reply", arpReply, broadcastMAC, []byte{
+            0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+            0x52, 0x54, 0x00, 0x12, 0x34, 0x56,
+            0x08, 0x06,
+            0x00, 0x01, 0x08, 0x00, 6, 4,
+            0x00, 0x02, // Reply
+            0x52, 0x54, 0x00, 0x12, 0x34, 0x56, 192, 168, 1, 200,
+            0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 192, 168, 1, 200,
+        }},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := garpFrame(mac, ip, tt.op, tt.targetMAC)
+            if !bytes.Equal(got, tt.want) {
+                t.Errorf("garpFrame() =\n% x\nwant\n% x", got, tt.want)
+            }
+            // Gratuitous: the sender and target protocol addresses match
+            if !bytes.Equal(got[28:32], got[38:42]) {
+                t.Errorf("sender IP % x differs from target IP % x", got[28:32], got[38:42])
+            }
+        })
+    }
+}
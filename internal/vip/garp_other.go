@@ -0,0 +1,13 @@
+//go:build !linux
+
+package vip
+
+import (
+    "errors"
+    "net"
+    "time"
+)
+
+func sendNativeGARP(ifaceName string, ip net.IP, count int, interval time.Duration) error {
+    return errors.New("native gratuitous ARP is only supported on Linux")
+}
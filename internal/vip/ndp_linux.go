@@ -0,0 +1,128 @@
+package vip
+
+import (
+    "encoding/binary"
+    "fmt"
+    "net"
+    "time"
+
+    "golang.org/x/sys/unix"
+)
+
+const (
+    etherTypeIPv6               = 0x86dd
+    protoICMPv6                 = 58
+    icmpv6NeighborAdvertisement = 136
+    ndpOptTargetLinkLayerAddr   = 2
+    naFlagOverride              = 0x20
+)
+
+var (
+    allNodesIPv6 = net.ParseIP("ff02::1")
+    allNodesMAC  = net.HardwareAddr{0x33, 0x33, 0x00, 0x00, 0x00, 0x01}
+)
+
+// sendUnsolicitedNA announces ip on iface with unsolicited Neighbor
+// Advertisements (override flag set) to the all-nodes multicast group, the
+// IPv6 equivalent of gratuitous ARP. Like sendNativeGARP it only needs
+// CAP_NET_RAW.
+func sendUnsolicitedNA(ifaceName string, ip net.IP, count int, interval time.Duration) error {
+    if ip.To4() != nil || ip.To16() == nil {
+        return fmt.Errorf("%s is not an IPv6 address", ip)
+    }
+
+    iface, err := net.InterfaceByName(ifaceName)
+    if err != nil {
+        return fmt.Errorf("interface %s: %w", ifaceName, err)
+    }
+    if len(iface.HardwareAddr) != 6 {
+        return fmt.Errorf("interface %s has no Ethernet address", ifaceName)
+    }
+
+    fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW|unix.SOCK_CLOEXEC, int(htons(etherTypeIPv6)))
+    if err != nil {
+        return fmt.Errorf("failed to open packet socket (CAP_NET_RAW required): %w", err)
+    }
+    defer unix.Close(fd)
+
+    addr := &unix.SockaddrLinklayer{
+        Protocol: htons(etherTypeIPv6),
+        Ifindex:  iface.Index,
+        Halen:    6,
+    }
+    copy(addr.Addr[:], allNodesMAC)
+
+    frame := naFrame(iface.HardwareAddr, ip.To16())
+
+    if count < 1 {
+        count = 1
+    }
+    for i := 0; i < count; i++ {
+        if i > 0 {
+            time.Sleep(interval)
+        }
+        if err := unix.Sendto(fd, frame, 0, addr); err != nil {
+            return fmt.Errorf("failed to send neighbor advertisement on %s: %w", ifaceName, err)
+        }
+    }
+
+    return nil
+}
+
+// naFrame builds an Ethernet frame carrying an unsolicited Neighbor
+// Advertisement for ip with a target link-layer address option.
+func naFrame(mac net.HardwareAddr, ip net.IP) []byte {
+    const icmpLen = 4 + 4 + 16 + 8 // header, flags, target, option
+    frame := make([]byte, 14+40+icmpLen)
+
+    // Ethernet header
+    copy(frame[0:6], allNodesMAC)
+    copy(frame[6:12], mac)
+    binary.BigEndian.PutUint16(frame[12:14], etherTypeIPv6)
+
+    // IPv6 header; neighbor discovery requires a hop limit of 255
+    ipv6 := frame[14:54]
+    ipv6[0] = 0x60
+    binary.BigEndian.PutUint16(ipv6[4:6], icmpLen)
+    ipv6[6] = protoICMPv6
+    ipv6[7] = 255
+    copy(ipv6[8:24], ip)
+    copy(ipv6[24:40], allNodesIPv6)
+
+    // ICMPv6 Neighbor Advertisement
+    icmp := frame[54:]
+    icmp[0] = icmpv6NeighborAdvertisement
+    icmp[4] = naFlagOverride
+    copy(icmp[8:24], ip)
+    icmp[24] = ndpOptTargetLinkLayerAddr
+    icmp[25] = 1 // Option length in units of 8 bytes
+    copy(icmp[26:32], mac)
+
+    binary.BigEndian.PutUint16(icmp[2:4], icmpv6Checksum(ip, allNodesIPv6, icmp))
+    return frame
+}
+
+// icmpv6Checksum computes the ICMPv6 checksum over the IPv6 pseudo-header
+// and the ICMPv6 message (with its checksum field zeroed).
+func icmpv6Checksum(src, dst net.IP, msg []byte) uint16 {
+    var sum uint32
+    add := func(b []byte) {
+        for i := 0; i+1 < len(b); i += 2 {
+            sum += uint32(binary.BigEndian.Uint16(b[i : i+2]))
+        }
+        if len(b)%2 == 1 {
+            sum += uint32(b[len(b)-1]) << 8
+        }
+    }
+
+    add(src.To16())
+    add(dst.To16())
+    sum += uint32(len(msg))
+    sum += protoICMPv6
+    add(msg)
+
+    for sum>>16 != 0 {
+        sum = sum&0xffff + sum>>16
+    }
+    return ^uint16(sum)
+}
@@ -0,0 +1,128 @@
+package vip
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "net"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestNAFrame(t *testing.T) {
+    mac := net.HardwareAddr{0x52, 0x54, 0x00, 0x12, 0x34, 0x56}
+    ip := net.ParseIP("2001:db8::10")
+    frame := naFrame(mac, ip)
+
+    if len(frame) != 14+40+32 {
+        t.Fatalf("frame is %d bytes, want %d", len(frame), 14+40+32)
+    }
+    if !bytes.Equal(frame[0:6], allNodesMAC) || !bytes.Equal(frame[6:12], mac) {
+        t.Errorf("Ethernet addresses = % x -> % x", frame[6:12], frame[0:6])
+    }
+    if etherType := binary.BigEndian.Uint16(frame[12:14]); etherType != etherTypeIPv6 {
+        t.Errorf("ethertype = %#04x, want %#04x", etherType, etherTypeIPv6)
+    }
+
+    ipv6 := frame[14:54]
+    if ipv6[6] != protoICMPv6 || ipv6[7] != 255 {
+        t.Errorf("next header = %d, hop limit = %d, want %d and 255", ipv6[6], ipv6[7], protoICMPv6)
+    }
+    if !net.IP(ipv6[8:24]).Equal(ip) || !net.IP(ipv6[24:40]).Equal(allNodesIPv6) {
+        t.Errorf("IPv6 addresses = %v -> %v", net.IP(ipv6[8:24]), net.IP(ipv6[24:40]))
+    }
+
+    icmp := frame[54:]
+    if icmp[0] != icmpv6NeighborAdvertisement || icmp[1] != 0 {
+        t.Errorf("type = %d, code = %d, want %d and 0", icmp[0], icmp[1], icmpv6NeighborAdvertisement)
+    }
+    // Override set; router and solicited clear, as for any unsolicited NA
+    if icmp[4] != naFlagOverride {
+        t.Errorf("flags = %#02x, want override only (%#02x)", icmp[4], naFlagOverride)
+    }
+    if !net.IP(icmp[8:24]).Equal(ip) {
+        t.Errorf("target = %v, want %v", net.IP(icmp[8:24]), ip)
+    }
+    if icmp[24] != ndpOptTargetLinkLayerAddr || icmp[25] != 1 || !bytes.Equal(icmp[26:32], mac) {
+        t.Errorf("option = % x, want target link-layer address %s", icmp[24:32], mac)
+    }
+
+    // Computed independently over the pseudo-header and message (RFC 4443)
+    if checksum := binary.BigEndian.Uint16(icmp[2:4]); checksum != 0x7451 {
+        t.Errorf("checksum = %#04x, want 0x7451", checksum)
+    }
+}
+
+func TestICMPv6Checksum(t *testing.T) {
+    src := net.ParseIP("fe80::1")
+    dst := net.ParseIP("ff02::1")
+
+    tests := []struct {
+        name string
+        msg  []byte
+    }{
+        {"even length", []byte{136, 0, 0, 0, 0x20, 0, 0, 0}},
+        {"odd length", []byte{128, 0, 0, 0, 0, 1, 0, 1, 0xab}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            msg := append([]byte(nil), tt.msg...)
+            binary.BigEndian.PutUint16(msg[2:4], icmpv6Checksum(src, dst, msg))
+            // A receiver checksumming the message with the checksum in
+            // place gets zero
+            if got := icmpv6Checksum(src, dst, msg); got != 0 {
+                t.Errorf("checksum over the checksummed message = %#04x, want 0", got)
+            }
+        })
+    }
+}
+
+func TestWaitForDAD(t *testing.T) {
+    defer func(timeout time.Duration) { dadTimeout = timeout }(dadTimeout)
+    dadTimeout = 300 * time.Millisecond
+    addr, _ := parseVIP("2001:db8::10/64")
+
+    tests := []struct {
+        name      string
+        tentative int // Polls that report the address as tentative
+        failed    bool
+        err       error
+        wantIs    error
+        wantErr   string
+    }{
+        {"not tentative", 0, false, nil, nil, ""},
+        {"tentative for a while", 2, false, nil, nil, ""},
+        {"duplicate", 1, true, nil, ErrDuplicateAddress, ""},
+        {"state unavailable", 0, false, errors.New("address not found"), nil, "address not found"},
+        {"timeout", 1000, false, nil, nil, "timed out"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            polls := 0
+            err := waitForDAD(addr, func() (bool, bool, error) {
+                polls++
+                if tt.err != nil {
+                    return false, false, tt.err
+                }
+                if polls <= tt.tentative {
+                    return true, false, nil
+                }
+                return false, tt.failed, nil
+            })
+
+            switch {
+            case tt.wantIs != nil:
+                if !errors.Is(err, tt.wantIs) {
+                    t.Errorf("waitForDAD() = %v, want %v", err, tt.wantIs)
+                }
+            case tt.wantErr != "":
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Errorf("waitForDAD() = %v, want an error containing %q", err, tt.wantErr)
+                }
+            case err != nil:
+                t.Errorf("waitForDAD() = %v", err)
+            }
+        })
+    }
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package vip
+
+import (
+    "errors"
+    "net"
+    "time"
+)
+
+func sendUnsolicitedNA(ifaceName string, ip net.IP, count int, interval time.Duration) error {
+    return errors.New("unsolicited neighbor advertisements are only supported on Linux")
+}
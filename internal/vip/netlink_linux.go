@@ -0,0 +1,236 @@
+package vip
+
+import (
+    "encoding/binary"
+    "fmt"
+    "net"
+    "sync"
+    "syscall"
+
+    "golang.org/x/sys/unix"
+)
+
+// netlinkManager manages addresses through rtnetlink, without needing
+// iproute2 on the host.
+type netlinkManager struct {
+    mu  sync.Mutex
+    seq uint32
+}
+
+func newNetlinkManager() (AddressManager, error) {
+    // Make sure a route netlink socket can be opened at all
+    fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open netlink socket: %w", err)
+    }
+    unix.Close(fd)
+    return &netlinkManager{}, nil
+}
+
+func (m *netlinkManager) Name() string {
+    return "netlink"
+}
+
+func (m *netlinkManager) AddAddress(iface string, addr *net.IPNet, opts AddressOptions) error {
+    link, err := net.InterfaceByName(iface)
+    if err != nil {
+        return fmt.Errorf("interface %s: %w", iface, err)
+    }
+
+    payload := newAddrPayload(link.Index, addr)
+    if addr.IP.To4() != nil && opts.Label != "" {
+        payload = appendAttr(payload, unix.IFA_LABEL, append([]byte(addressLabel(iface, opts.Label)), 0))
+    }
+    if opts.PreferredLifetime >= 0 {
+        cacheInfo := make([]byte, unix.SizeofIfaCacheinfo)
+        binary.NativeEndian.PutUint32(cacheInfo[0:4], uint32(opts.PreferredLifetime))
+        binary.NativeEndian.PutUint32(cacheInfo[4:8], 0xFFFFFFFF) // valid_lft forever
+        payload = appendAttr(payload, unix.IFA_CACHEINFO, cacheInfo)
+    }
+    if opts.NoDAD && addr.IP.To4() == nil {
+        flags := make([]byte, 4)
+        binary.NativeEndian.PutUint32(flags, unix.IFA_F_NODAD)
+        payload = appendAttr(payload, unix.IFA_FLAGS, flags)
+    }
+
+    err = m.request(unix.RTM_NEWADDR, unix.NLM_F_CREATE|unix.NLM_F_EXCL, payload)
+    if err == unix.EEXIST {
+        return nil
+    }
+    if err != nil {
+        return fmt.Errorf("netlink add %s dev %s: %w", addr, iface, err)
+    }
+    if needsDAD(addr, opts) {
+        if err := waitForDAD(addr, func() (bool, bool, error) { return m.dadState(link.Index, addr) }); err != nil {
+            m.DeleteAddress(iface, addr)
+            return err
+        }
+    }
+    return nil
+}
+
+// dadState dumps the IPv6 addresses of the interface and reports whether
+// addr is still tentative or failed duplicate address detection.
+func (m *netlinkManager) dadState(index int, addr *net.IPNet) (bool, bool, error) {
+    req := make([]byte, unix.SizeofIfAddrmsg)
+    req[0] = unix.AF_INET6
+
+    replies, err := m.roundTrip(unix.RTM_GETADDR, unix.NLM_F_DUMP, req)
+    if err != nil {
+        return false, false, fmt.Errorf("netlink dump addresses: %w", err)
+    }
+
+    for _, reply := range replies {
+        if reply.Header.Type != unix.RTM_NEWADDR || len(reply.Data) < unix.SizeofIfAddrmsg {
+            continue
+        }
+        if int(binary.NativeEndian.Uint32(reply.Data[4:8])) != index {
+            continue
+        }
+
+        flags := uint32(reply.Data[2])
+        var address net.IP
+        attrs, err := syscall.ParseNetlinkRouteAttr(&reply)
+        if err != nil {
+            continue
+        }
+        for _, attr := range attrs {
+            switch attr.Attr.Type {
+            case unix.IFA_ADDRESS:
+                address = net.IP(attr.Value)
+            case unix.IFA_FLAGS:
+                if len(attr.Value) >= 4 {
+                    flags = binary.NativeEndian.Uint32(attr.Value[0:4])
+                }
+            }
+        }
+
+        if address.Equal(addr.IP) {
+            return flags&unix.IFA_F_TENTATIVE != 0, flags&unix.IFA_F_DADFAILED != 0, nil
+        }
+    }
+
+    return false, false, fmt.Errorf("address %s not found on interface index %d", addr.IP, index)
+}
+
+func (m *netlinkManager) DeleteAddress(iface string, addr *net.IPNet) error {
+    link, err := net.InterfaceByName(iface)
+    if err != nil {
+        return fmt.Errorf("interface %s: %w", iface, err)
+    }
+
+    err = m.request(unix.RTM_DELADDR, 0, newAddrPayload(link.Index, addr))
+    if err == unix.EADDRNOTAVAIL {
+        return nil
+    }
+    if err != nil {
+        return fmt.Errorf("netlink del %s dev %s: %w", addr, iface, err)
+    }
+    return nil
+}
+
+// newAddrPayload builds an ifaddrmsg with IFA_LOCAL/IFA_ADDRESS attributes.
+func newAddrPayload(index int, addr *net.IPNet) []byte {
+    family := unix.AF_INET6
+    ip := addr.IP.To16()
+    if ip4 := addr.IP.To4(); ip4 != nil {
+        family = unix.AF_INET
+        ip = ip4
+    }
+    prefixLen, _ := addr.Mask.Size()
+
+    msg := make([]byte, unix.SizeofIfAddrmsg)
+    msg[0] = byte(family)
+    msg[1] = byte(prefixLen)
+    binary.NativeEndian.PutUint32(msg[4:8], uint32(index))
+
+    msg = appendAttr(msg, unix.IFA_LOCAL, ip)
+    return appendAttr(msg, unix.IFA_ADDRESS, ip)
+}
+
+func appendAttr(b []byte, attrType uint16, data []byte) []byte {
+    attrLen := unix.SizeofRtAttr + len(data)
+    header := make([]byte, unix.SizeofRtAttr)
+    binary.NativeEndian.PutUint16(header[0:2], uint16(attrLen))
+    binary.NativeEndian.PutUint16(header[2:4], attrType)
+
+    b = append(b, header...)
+    b = append(b, data...)
+    return append(b, make([]byte, nlmAlign(attrLen)-attrLen)...)
+}
+
+func nlmAlign(n int) int {
+    return (n + unix.NLMSG_ALIGNTO - 1) &^ (unix.NLMSG_ALIGNTO - 1)
+}
+
+// request sends a single netlink request and waits for the kernel's ack,
+// returning the errno it reported, if any.
+func (m *netlinkManager) request(msgType uint16, flags uint16, payload []byte) error {
+    _, err := m.roundTrip(msgType, flags|unix.NLM_F_ACK, payload)
+    return err
+}
+
+// roundTrip sends a netlink request and collects the messages the kernel
+// sends back until the ack, error or end of a multipart dump.
+func (m *netlinkManager) roundTrip(msgType uint16, flags uint16, payload []byte) ([]syscall.NetlinkMessage, error) {
+    fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+    if err != nil {
+        return nil, err
+    }
+    defer unix.Close(fd)
+
+    if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+        return nil, err
+    }
+
+    m.mu.Lock()
+    m.seq++
+    seq := m.seq
+    m.mu.Unlock()
+
+    msg := make([]byte, unix.SizeofNlMsghdr, unix.SizeofNlMsghdr+len(payload))
+    binary.NativeEndian.PutUint32(msg[0:4], uint32(unix.SizeofNlMsghdr+len(payload)))
+    binary.NativeEndian.PutUint16(msg[4:6], msgType)
+    binary.NativeEndian.PutUint16(msg[6:8], flags|unix.NLM_F_REQUEST)
+    binary.NativeEndian.PutUint32(msg[8:12], seq)
+    msg = append(msg, payload...)
+
+    if err := unix.Sendto(fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+        return nil, err
+    }
+
+    var replies []syscall.NetlinkMessage
+    buf := make([]byte, 65536)
+    for {
+        n, _, err := unix.Recvfrom(fd, buf, 0)
+        if err != nil {
+            return nil, err
+        }
+        msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+        if err != nil {
+            return nil, err
+        }
+        for _, reply := range msgs {
+            if reply.Header.Seq != seq {
+                continue
+            }
+            switch reply.Header.Type {
+            case unix.NLMSG_DONE:
+                return replies, nil
+            case unix.NLMSG_ERROR:
+                if len(reply.Data) < 4 {
+                    return nil, fmt.Errorf("truncated netlink error message")
+                }
+                if errno := int32(binary.NativeEndian.Uint32(reply.Data[0:4])); errno != 0 {
+                    return nil, syscall.Errno(-errno)
+                }
+                return replies, nil
+            default:
+                replies = append(replies, reply)
+                if reply.Header.Flags&unix.NLM_F_MULTI == 0 && flags&unix.NLM_F_ACK == 0 {
+                    return replies, nil
+                }
+            }
+        }
+    }
+}
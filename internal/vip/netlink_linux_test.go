@@ -0,0 +1,89 @@
+package vip
+
+import (
+    "bytes"
+    "encoding/binary"
+    "testing"
+
+    "golang.org/x/sys/unix"
+)
+
+// rtattr encodes one route attribute the way the kernel expects it
+func rtattr(attrType uint16, data ...byte) []byte {
+    b := make([]byte, 4, 4+len(data)+3)
+    binary.NativeEndian.PutUint16(b[0:2], uint16(4+len(data)))
+    binary.NativeEndian.PutUint16(b[2:4], attrType)
+    b = append(b, data...)
+    for len(b)%4 != 0 {
+        b = append(b, 0)
+    }
+    return b
+}
+
+// ifaddrmsg encodes the fixed header of an address request
+func ifaddrmsg(family, prefixLen byte, index uint32) []byte {
+    b := []byte{family, prefixLen, 0, 0, 0, 0, 0, 0}
+    binary.NativeEndian.PutUint32(b[4:8], index)
+    return b
+}
+
+func TestNewAddrPayload(t *testing.T) {
+    v6 := []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x10}
+
+    tests := []struct {
+        vip   string
+        index int
+        want  [][]byte
+    }{
+        {"192.168.1.200/24", 2, [][]byte{
+            ifaddrmsg(unix.AF_INET, 24, 2),
+            rtattr(unix.IFA_LOCAL, 192, 168, 1, 200),
+            rtattr(unix.IFA_ADDRESS, 192, 168, 1, 200),
+        }},
+        {"10.0.0.1", 7, [][]byte{
+            ifaddrmsg(unix.AF_INET, 32, 7),
+            rtattr(unix.IFA_LOCAL, 10, 0, 0, 1),
+            rtattr(unix.IFA_ADDRESS, 10, 0, 0, 1),
+        }},
+        {"2001:db8::10/64", 3, [][]byte{
+            ifaddrmsg(unix.AF_INET6, 64, 3),
+            rtattr(unix.IFA_LOCAL, v6...),
+            rtattr(unix.IFA_ADDRESS, v6...),
+        }},
+    }
+    for _, tt := range tests {
+        addr, err := parseVIP(tt.vip)
+        if err != nil {
+            t.Fatal(err)
+        }
+        got := newAddrPayload(tt.index, addr)
+        if want := bytes.Join(tt.want, nil); !bytes.Equal(got, want) {
+            t.Errorf("newAddrPayload(%d, %s) =\n% x\nwant\n% x", tt.index, tt.vip, got, want)
+        }
+    }
+}
+
+func TestAppendAttr(t *testing.T) {
+    tests := []struct {
+        name     string
+        attrType uint16
+        data     []byte
+        want     []byte
+    }{
+        {"aligned", unix.IFA_FLAGS, []byte{1, 2, 3, 4}, rtattr(unix.IFA_FLAGS, 1, 2, 3, 4)},
+        {"padded", unix.IFA_LABEL, []byte("eth0:vip\x00"), rtattr(unix.IFA_LABEL, []byte("eth0:vip\x00")...)},
+        {"empty", unix.IFA_LABEL, nil, rtattr(unix.IFA_LABEL)},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            prefix := []byte{0xaa, 0xbb, 0xcc, 0xdd}
+            got := appendAttr(append([]byte(nil), prefix...), tt.attrType, tt.data)
+            if want := append(prefix, tt.want...); !bytes.Equal(got, want) {
+                t.Errorf("appendAttr() = % x, want % x", got, want)
+            }
+            if len(got)%unix.NLMSG_ALIGNTO != 0 {
+                t.Errorf("appendAttr() left %d bytes, not aligned", len(got))
+            }
+        })
+    }
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package vip
+
+import "errors"
+
+func newNetlinkManager() (AddressManager, error) {
+    return nil, errors.New("netlink is only supported on Linux")
+}
@@ -1,6 +1,8 @@
 package vip
 
 import (
+    "errors"
+    "fmt"
     "log"
     "net"
     "os"
@@ -11,18 +13,24 @@ import (
 
     "github.com/2bleere/ha-vip/internal/config"
     "github.com/2bleere/ha-vip/internal/election"
+    "github.com/2bleere/ha-vip/internal/metrics"
 )
 
 type VIPManager struct {
     cfg           *config.Config
+    group         config.VIPGroup
     isAssigned    bool
     mu            sync.RWMutex
     stopCh        chan struct{}
     fastCheck     bool
     isNonRoot     bool  // Track if running as non-root user
+    addrs         AddressManager
+    vipAddrs      []*net.IPNet
+    addrOpts      AddressOptions
 }
 
-func NewVIPManager(cfg *config.Config) *VIPManager {
+// NewVIPManager creates the manager for the VIPs of one group
+func NewVIPManager(cfg *config.Config, group config.VIPGroup) *VIPManager {
     // Detect if running as non-root user
     isNonRoot := os.Getuid() != 0
     
@@ -32,10 +40,66 @@ func NewVIPManager(cfg *config.Config) *VIPManager {
         log.Printf("VIP Manager: Running as root user, will use optimal ARP methods")
     }
     
+    addrs, err := newAddressManager(cfg.VIPBackend)
+    if err != nil {
+        log.Fatalf("Failed to set up VIP backend: %v", err)
+    }
+    log.Printf("VIP Manager: Managing addresses with %s", addrs.Name())
+    
+    var vipAddrs []*net.IPNet
+    for _, vip := range group.VIPs {
+        vipAddr, err := parseVIP(vip)
+        if err != nil {
+            log.Fatalf("VIP Manager: group %s: %v", group.Name, err)
+        }
+        vipAddrs = append(vipAddrs, vipAddr)
+        metrics.VIPAssigned.Set(0, group.Name, vipAddr.String())
+    }
+    
+    addrOpts := AddressOptions{
+        Label:             cfg.VIPLabel,
+        PreferredLifetime: -1,
+        NoDAD:             cfg.VIPNoDAD,
+    }
+    if cfg.VIPPreferredLifetime != nil {
+        addrOpts.PreferredLifetime = *cfg.VIPPreferredLifetime
+    }
+    
     return &VIPManager{
         cfg:       cfg,
+        group:     group,
         stopCh:    make(chan struct{}),
         isNonRoot: isNonRoot,
+        addrs:     addrs,
+        vipAddrs:  vipAddrs,
+        addrOpts:  addrOpts,
+    }
+}
+
+// Status is a snapshot of the VIPs of one group on this node
+type Status struct {
+    Group     string   `json:"group"`
+    Interface string   `json:"interface"`
+    VIPs      []string `json:"vips"`
+    Assigned  bool     `json:"assigned"`
+    Backend   string   `json:"backend"`
+}
+
+// Status reports whether the group's VIPs are assigned to this node
+func (v *VIPManager) Status() Status {
+    v.mu.RLock()
+    defer v.mu.RUnlock()
+    
+    vips := make([]string, 0, len(v.vipAddrs))
+    for _, vipAddr := range v.vipAddrs {
+        vips = append(vips, vipAddr.String())
+    }
+    return Status{
+        Group:     v.group.Name,
+        Interface: v.group.Interface,
+        VIPs:      vips,
+        Assigned:  v.isAssigned,
+        Backend:   v.addrs.Name(),
     }
 }
 
@@ -44,7 +108,8 @@ func (v *VIPManager) Stop() {
 }
 
 func (v *VIPManager) MonitorLeadership(e *election.Election) {
-    log.Printf("VIP Manager: Starting leadership monitoring")
+    log.Printf("VIP Manager: Starting leadership monitoring for group %s (%s on %s)", 
+        v.group.Name, strings.Join(v.group.VIPs, ", "), v.group.Interface)
     
     // Start with immediate check
     v.checkAndUpdateVIP(e)
@@ -56,6 +121,14 @@ func (v *VIPManager) MonitorLeadership(e *election.Election) {
     ticker := time.NewTicker(500 * time.Millisecond)
     defer ticker.Stop()
     
+    // Periodically re-announce the VIP while we hold it
+    var refreshCh <-chan time.Time
+    if v.cfg.GARP.RefreshInterval > 0 {
+        refreshTicker := time.NewTicker(time.Duration(v.cfg.GARP.RefreshInterval) * time.Second)
+        defer refreshTicker.Stop()
+        refreshCh = refreshTicker.C
+    }
+    
     for {
         select {
         case newLeader := <-leaderChangeChan:
@@ -75,6 +148,9 @@ func (v *VIPManager) MonitorLeadership(e *election.Election) {
             ticker.Reset(interval)
             v.checkAndUpdateVIP(e)
             
+        case <-refreshCh:
+            v.refreshGratuitousARP()
+            
         case <-v.stopCh:
             log.Printf("VIP Manager: Stop signal received")
             return
@@ -84,69 +160,107 @@ func (v *VIPManager) MonitorLeadership(e *election.Election) {
 
 func (v *VIPManager) checkAndUpdateVIP(e *election.Election) {
     if e.IsLeader() {
-        v.AssignVIP()
+        if err := v.AssignVIP(); err != nil {
+            log.Printf("Failed to assign VIPs of group %s: %v", v.group.Name, err)
+        }
     } else {
-        v.ReleaseVIP()
+        if err := v.ReleaseVIP(); err != nil {
+            log.Printf("Failed to release VIPs of group %s: %v", v.group.Name, err)
+        }
     }
+    
+    v.mu.RLock()
+    assigned := v.isAssigned
+    v.mu.RUnlock()
+    e.SetVIPHeld(assigned)
 }
 
-func (v *VIPManager) AssignVIP() {
+// AssignVIP adds every VIP of the group. The group is assigned all or
+// nothing: if one VIP cannot be added, those already added are removed.
+func (v *VIPManager) AssignVIP() error {
     v.mu.Lock()
     defer v.mu.Unlock()
     
     if v.isAssigned {
-        return // Already assigned
+        return nil // Already assigned
     }
     
-    cmd := exec.Command("ip", "addr", "add", v.cfg.VIP, "dev", v.cfg.Interface)
-    if err := cmd.Run(); err != nil {
-        log.Printf("Failed to assign VIP %s: %v", v.cfg.VIP, err)
-        return
+    for i, vipAddr := range v.vipAddrs {
+        if err := v.addrs.AddAddress(v.group.Interface, vipAddr, v.addrOpts); err != nil {
+            for _, added := range v.vipAddrs[:i] {
+                v.addrs.DeleteAddress(v.group.Interface, added)
+            }
+            return fmt.Errorf("VIP %s: %w", vipAddr, err)
+        }
     }
     v.isAssigned = true
-    log.Printf("Successfully assigned VIP: %s", v.cfg.VIP)
+    for _, vipAddr := range v.vipAddrs {
+        metrics.VIPAssigned.Set(1, v.group.Name, vipAddr.String())
+    }
+    log.Printf("Successfully assigned VIP: %s", strings.Join(v.group.VIPs, ", "))
     
     // Send gratuitous ARP to notify network of VIP assignment
-    go v.sendGratuitousARP()
+    for _, vipAddr := range v.vipAddrs {
+        go v.sendGratuitousARP(vipAddr.IP)
+    }
+    return nil
 }
 
-func (v *VIPManager) ReleaseVIP() {
+// ReleaseVIP removes every VIP of the group
+func (v *VIPManager) ReleaseVIP() error {
     v.mu.Lock()
     defer v.mu.Unlock()
     
     if !v.isAssigned {
-        return // Already released
+        return nil // Already released
     }
     
-    cmd := exec.Command("ip", "addr", "del", v.cfg.VIP, "dev", v.cfg.Interface)
-    if err := cmd.Run(); err != nil {
-        log.Printf("Failed to release VIP %s: %v", v.cfg.VIP, err)
-        return
+    var errs []error
+    for _, vipAddr := range v.vipAddrs {
+        if err := v.addrs.DeleteAddress(v.group.Interface, vipAddr); err != nil {
+            errs = append(errs, fmt.Errorf("VIP %s: %w", vipAddr, err))
+            continue
+        }
+        metrics.VIPAssigned.Set(0, v.group.Name, vipAddr.String())
+    }
+    if len(errs) > 0 {
+        return errors.Join(errs...)
     }
     v.isAssigned = false
-    log.Printf("Successfully released VIP: %s", v.cfg.VIP)
+    log.Printf("Successfully released VIP: %s", strings.Join(v.group.VIPs, ", "))
+    return nil
 }
 
 // sendGratuitousARP sends gratuitous ARP packets to notify the network
 // of the VIP assignment, ensuring fast failover
-func (v *VIPManager) sendGratuitousARP() {
-    // Extract IP address from VIP (remove CIDR notation if present)
-    vipAddr := strings.Split(v.cfg.VIP, "/")[0]
+func (v *VIPManager) sendGratuitousARP(ip net.IP) {
+    vipAddr := ip.String()
     
-    // Parse IP address
-    ip := net.ParseIP(vipAddr)
-    if ip == nil {
-        log.Printf("Invalid VIP address for gratuitous ARP: %s", vipAddr)
-        return
-    }
+    count, interval := v.garpSettings()
     
-    // Only send gratuitous ARP for IPv4
+    // IPv6 has no ARP; announce with unsolicited Neighbor Advertisements
     if ip.To4() == nil {
-        log.Printf("Gratuitous ARP not supported for IPv6 address: %s", vipAddr)
+        if err := sendUnsolicitedNA(v.group.Interface, ip, count, interval); err != nil {
+            log.Printf("Failed to send unsolicited neighbor advertisement for %s: %v", vipAddr, err)
+            metrics.GARPSent.Inc("ndp", metrics.ResultFailure)
+            return
+        }
+        metrics.GARPSent.Inc("ndp", metrics.ResultSuccess)
+        log.Printf("Sent %d unsolicited neighbor advertisement(s) for %s on %s", count, vipAddr, v.group.Interface)
         return
     }
     
-    log.Printf("Sending gratuitous ARP for VIP %s on interface %s", vipAddr, v.cfg.Interface)
+    log.Printf("Sending gratuitous ARP for VIP %s on interface %s", vipAddr, v.group.Interface)
+    
+    // Preferred method: craft the ARP frames ourselves (needs CAP_NET_RAW)
+    if err := sendNativeGARP(v.group.Interface, ip, count, interval); err == nil {
+        metrics.GARPSent.Inc("native", metrics.ResultSuccess)
+        log.Printf("Sent %d gratuitous ARP announcement(s) for %s on %s", count, vipAddr, v.group.Interface)
+        return
+    } else {
+        metrics.GARPSent.Inc("native", metrics.ResultFailure)
+        log.Printf("Native gratuitous ARP failed: %v, falling back to external tools", err)
+    }
     
     // Check if running as non-root and skip arping attempts
     if v.isNonRoot {
@@ -157,34 +271,80 @@ func (v *VIPManager) sendGratuitousARP() {
     
     // Method 1: Use arping if available (most reliable) - only for root users
     if v.sendArping(vipAddr) {
+        metrics.GARPSent.Inc("arping", metrics.ResultSuccess)
         return
     }
+    metrics.GARPSent.Inc("arping", metrics.ResultFailure)
     
     // Method 2: Fallback to ping broadcast (triggers ARP)
     v.sendPingBroadcast(vipAddr)
 }
 
+// refreshGratuitousARP re-announces the VIP while it is assigned so that
+// neighbours whose caches expired or missed the first burst stay updated
+func (v *VIPManager) refreshGratuitousARP() {
+    v.mu.RLock()
+    assigned := v.isAssigned
+    v.mu.RUnlock()
+    
+    if !assigned {
+        return
+    }
+    
+    count, interval := v.garpSettings()
+    for _, vipAddr := range v.vipAddrs {
+        if vipAddr.IP.To4() == nil {
+            if err := sendUnsolicitedNA(v.group.Interface, vipAddr.IP, count, interval); err != nil {
+                log.Printf("Neighbor advertisement refresh failed for %s: %v", vipAddr.IP, err)
+                metrics.GARPSent.Inc("ndp", metrics.ResultFailure)
+            } else {
+                metrics.GARPSent.Inc("ndp", metrics.ResultSuccess)
+            }
+            continue
+        }
+        if err := sendNativeGARP(v.group.Interface, vipAddr.IP, count, interval); err != nil {
+            log.Printf("Gratuitous ARP refresh failed for %s: %v", vipAddr.IP, err)
+            metrics.GARPSent.Inc("native", metrics.ResultFailure)
+        } else {
+            metrics.GARPSent.Inc("native", metrics.ResultSuccess)
+        }
+    }
+}
+
+// garpSettings returns the configured burst size and spacing
+func (v *VIPManager) garpSettings() (int, time.Duration) {
+    count := v.cfg.GARP.Count
+    if count <= 0 {
+        count = 3
+    }
+    interval := time.Duration(v.cfg.GARP.IntervalMs) * time.Millisecond
+    if interval <= 0 {
+        interval = 200 * time.Millisecond
+    }
+    return count, interval
+}
+
 // sendArping sends gratuitous ARP using the arping tool (root users only)
 func (v *VIPManager) sendArping(vipAddr string) bool {
     // This method should only be called for root users
     // Try arping with different approaches for maximum compatibility
     
     // Method 1: Try arping with gratuitous announce flag
-    cmd := exec.Command("arping", "-A", "-c", "3", "-I", v.cfg.Interface, vipAddr)
+    cmd := exec.Command("arping", "-A", "-c", "3", "-I", v.group.Interface, vipAddr)
     if err := cmd.Run(); err == nil {
         log.Printf("Sent gratuitous ARP using arping -A for %s", vipAddr)
         return true
     }
     
     // Method 2: Try arping with unsolicited flag
-    cmd = exec.Command("arping", "-U", "-c", "3", "-I", v.cfg.Interface, vipAddr)
+    cmd = exec.Command("arping", "-U", "-c", "3", "-I", v.group.Interface, vipAddr)
     if err := cmd.Run(); err == nil {
         log.Printf("Sent gratuitous ARP using arping -U for %s", vipAddr)
         return true
     }
     
     // Method 3: Try basic arping
-    cmd = exec.Command("arping", "-c", "1", "-I", v.cfg.Interface, vipAddr)
+    cmd = exec.Command("arping", "-c", "1", "-I", v.group.Interface, vipAddr)
     if err := cmd.Run(); err == nil {
         log.Printf("Sent ARP using arping (basic mode) for %s", vipAddr)
         return true
@@ -195,7 +355,7 @@ func (v *VIPManager) sendArping(vipAddr string) bool {
         return true
     }
     
-    log.Printf("arping not available or failed for interface %s", v.cfg.Interface)
+    log.Printf("arping not available or failed for interface %s", v.group.Interface)
     return false
 }
 
@@ -203,10 +363,10 @@ func (v *VIPManager) sendArping(vipAddr string) bool {
 func (v *VIPManager) sendIPNeighborAnnounce(vipAddr string) bool {
     // Use ip command to manipulate neighbor table (may work with CAP_NET_ADMIN)
     // First, try to add a temporary neighbor entry, then delete it to trigger announcement
-    cmd := exec.Command("ip", "neigh", "add", vipAddr, "lladdr", "00:00:00:00:00:00", "dev", v.cfg.Interface)
+    cmd := exec.Command("ip", "neigh", "add", vipAddr, "lladdr", "00:00:00:00:00:00", "dev", v.group.Interface)
     if err := cmd.Run(); err == nil {
         // Delete the entry to clean up and potentially trigger announcements
-        cmd = exec.Command("ip", "neigh", "del", vipAddr, "dev", v.cfg.Interface)
+        cmd = exec.Command("ip", "neigh", "del", vipAddr, "dev", v.group.Interface)
         cmd.Run() // Ignore error on cleanup
         log.Printf("Sent neighbor announcement using ip command for %s", vipAddr)
         return true
@@ -235,15 +395,15 @@ func (v *VIPManager) sendPingBroadcast(vipAddr string) {
 // sendNetworkBroadcast sends broadcast ping to the network
 func (v *VIPManager) sendNetworkBroadcast(vipAddr string) {
     // Get network information for broadcast address
-    iface, err := net.InterfaceByName(v.cfg.Interface)
+    iface, err := net.InterfaceByName(v.group.Interface)
     if err != nil {
-        log.Printf("Failed to get interface %s: %v", v.cfg.Interface, err)
+        log.Printf("Failed to get interface %s: %v", v.group.Interface, err)
         return
     }
     
     addrs, err := iface.Addrs()
     if err != nil {
-        log.Printf("Failed to get addresses for interface %s: %v", v.cfg.Interface, err)
+        log.Printf("Failed to get addresses for interface %s: %v", v.group.Interface, err)
         return
     }
     
@@ -265,7 +425,7 @@ func (v *VIPManager) sendNetworkBroadcast(vipAddr string) {
         }
         
         // Send ping to broadcast (this will trigger ARP resolution)
-        cmd := exec.Command("ping", "-c", "1", "-W", "1", "-I", v.cfg.Interface, broadcast.String())
+        cmd := exec.Command("ping", "-c", "1", "-W", "1", "-I", v.group.Interface, broadcast.String())
         if err := cmd.Run(); err == nil {
             log.Printf("Sent broadcast ping from %s to %s", vipAddr, broadcast.String())
         }
@@ -282,7 +442,7 @@ func (v *VIPManager) sendGatewayPings(vipAddr string) {
     }
     
     // Get interface addresses to find the network
-    iface, err := net.InterfaceByName(v.cfg.Interface)
+    iface, err := net.InterfaceByName(v.group.Interface)
     if err != nil {
         return
     }
@@ -314,7 +474,7 @@ func (v *VIPManager) sendGatewayPings(vipAddr string) {
         // Ping these addresses to ensure our ARP entry is noticed
         for _, gw := range []net.IP{gateway1, gateway254} {
             if ipNet.Contains(gw) {
-                cmd := exec.Command("ping", "-c", "1", "-W", "1", "-I", v.cfg.Interface, gw.String())
+                cmd := exec.Command("ping", "-c", "1", "-W", "1", "-I", v.group.Interface, gw.String())
                 if err := cmd.Run(); err == nil {
                     log.Printf("Sent gateway ping to %s to announce %s", gw.String(), vipAddr)
                 }
@@ -51,8 +51,8 @@ if [ ! -f "$CONFIG_DIR/config.yaml" ]; then
 fi
 
 echo "3. Setting network capabilities on binary..."
-setcap 'cap_net_admin=+ep' "$BINARY_PATH"
-echo "   Granted CAP_NET_ADMIN to $BINARY_PATH"
+setcap 'cap_net_admin,cap_net_raw=+ep' "$BINARY_PATH"
+echo "   Granted CAP_NET_ADMIN and CAP_NET_RAW to $BINARY_PATH"
 
 # Verify capabilities
 CAPS=$(getcap "$BINARY_PATH")
@@ -20,7 +20,7 @@ func main() {
     }
     
     // Create VIP manager (this should detect non-root status)
-    vipMgr := vip.NewVIPManager(cfg)
+    vipMgr := vip.NewVIPManager(cfg, cfg.Groups()[0])
     
     fmt.Printf("VIP Manager created successfully\n")
     fmt.Printf("Non-root detection test completed\n")